@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+)
+
+const importBatchSize = 500
+
+func runAds(args []string) error {
+	fs := flag.NewFlagSet("ads", flag.ExitOnError)
+	file := fs.String("file", "", "CSV (id,image_url,target_url with a header row) or JSON array of ads")
+	format := fs.String("format", "", "csv or json (default from the file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate the file without writing anything")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: adsmetrics ads import -file PATH [-format csv|json] [-dry-run]")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing ads action")
+	}
+	if args[0] != "import" {
+		fs.Usage()
+		return fmt.Errorf("unknown ads action %q", args[0])
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return errors.New("-file is required")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ads, err := readAds(f, *format)
+	if err != nil {
+		return err
+	}
+	if err := validateAds(ads); err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d ads are valid\n", len(ads))
+		return nil
+	}
+
+	cfg := config.NewConfig()
+	postgres, err := db.ConnectPostgreSQL(cfg)
+	if err != nil {
+		return err
+	}
+	adsRepo := repo.NewAdsRepository(postgres, repo.Guards{})
+
+	for i := 0; i < len(ads); i += importBatchSize {
+		end := min(i+importBatchSize, len(ads))
+		if err := adsRepo.UpsertAds(context.Background(), ads[i:end]); err != nil {
+			return fmt.Errorf("import stopped after %d ads: %w", i, err)
+		}
+	}
+
+	fmt.Printf("imported %d ads\n", len(ads))
+	return nil
+}
+
+func readAds(r io.Reader, format string) ([]model.Ad, error) {
+	switch format {
+	case "json":
+		var ads []model.Ad
+		if err := json.NewDecoder(r).Decode(&ads); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return ads, nil
+
+	case "csv":
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[strings.TrimSpace(strings.ToLower(name))] = i
+		}
+		for _, name := range []string{"id", "image_url", "target_url"} {
+			if _, ok := columns[name]; !ok {
+				return nil, fmt.Errorf("CSV header is missing column %q", name)
+			}
+		}
+
+		ads := make([]model.Ad, 0, len(records)-1)
+		for _, rec := range records[1:] {
+			ads = append(ads, model.Ad{
+				ID:        strings.TrimSpace(rec[columns["id"]]),
+				ImageURL:  strings.TrimSpace(rec[columns["image_url"]]),
+				TargetURL: strings.TrimSpace(rec[columns["target_url"]]),
+			})
+		}
+		return ads, nil
+
+	default:
+		return nil, fmt.Errorf("unknown format %q (csv|json)", format)
+	}
+}
+
+// validateAds checks the ads fit the ads table and IDs are unique
+func validateAds(ads []model.Ad) error {
+	seen := make(map[string]bool, len(ads))
+	var problems []string
+
+	for i, ad := range ads {
+		switch {
+		case ad.ID == "" || len(ad.ID) > 36:
+			problems = append(problems, fmt.Sprintf("ad %d: id must be 1-36 characters", i+1))
+		case seen[ad.ID]:
+			problems = append(problems, fmt.Sprintf("ad %d: duplicate id %q", i+1, ad.ID))
+		case ad.ImageURL == "" || ad.TargetURL == "":
+			problems = append(problems, fmt.Sprintf("ad %q: image_url and target_url are required", ad.ID))
+		case len(ad.ImageURL) > 2048 || len(ad.TargetURL) > 2048:
+			problems = append(problems, fmt.Sprintf("ad %q: URLs must be at most 2048 characters", ad.ID))
+		}
+		seen[ad.ID] = true
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d invalid ads:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
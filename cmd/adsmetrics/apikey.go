@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/services"
+)
+
+func runAPIKey(args []string) error {
+	fs := flag.NewFlagSet("apikey", flag.ExitOnError)
+	name := fs.String("name", "", "who or what the key is for (create only)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: adsmetrics apikey create -name NAME")
+		fmt.Fprintln(os.Stderr, "       adsmetrics apikey revoke <id|prefix>")
+		fmt.Fprintln(os.Stderr, "       adsmetrics apikey list")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing apikey action")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg := config.NewConfig()
+	postgres, err := db.ConnectPostgreSQL(cfg)
+	if err != nil {
+		return err
+	}
+	keys := services.NewAPIKeyService(repo.NewAdsRepository(postgres, repo.Guards{}))
+	ctx := context.Background()
+
+	switch action {
+	case "create":
+		key, record, err := keys.Create(ctx, *name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created api key %s (%s) for %q\n\n%s\n\n", record.ID, record.Prefix, record.Name, key)
+		fmt.Println("Store it now: the key can't be shown again.")
+		return nil
+
+	case "revoke":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errors.New("revoke takes exactly one key id or prefix")
+		}
+		revoked, err := keys.Revoke(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if revoked == 0 {
+			return fmt.Errorf("no active api key matches %q", fs.Arg(0))
+		}
+		fmt.Printf("revoked %d api key(s)\n", revoked)
+		return nil
+
+	case "list":
+		records, err := keys.List(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPREFIX\tNAME\tCREATED AT\tREVOKED AT")
+		for _, k := range records {
+			revokedAt := "-"
+			if k.RevokedAt != nil {
+				revokedAt = k.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Prefix, k.Name, k.CreatedAt.Format(time.RFC3339), revokedAt)
+		}
+		return w.Flush()
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown apikey action %q", action)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+	"gorm.io/gorm"
+)
+
+type benchResult struct {
+	writer   string
+	rows     int
+	inserted int
+	elapsed  time.Duration
+	batches  []time.Duration
+}
+
+// runBenchWriter compares click writers against a live database. Inserted
+// rows are removed (and counters restored) afterwards unless -keep is set,
+// but it should still be pointed at a scratch or staging database.
+func runBenchWriter(args []string) error {
+	fs := flag.NewFlagSet("bench-writer", flag.ExitOnError)
+	rows := fs.Int("rows", 50000, "clicks to write per writer")
+	batch := fs.Int("batch", 500, "clicks per batch")
+	writers := fs.String("writers", "insert,copy", "comma separated writers to compare")
+	keep := fs.Bool("keep", false, "keep benchmark rows instead of deleting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *rows < 1 || *batch < 1 {
+		return errors.New("-rows and -batch must be positive")
+	}
+
+	cfg := config.NewConfig()
+	postgres, err := db.ConnectPostgreSQL(cfg)
+	if err != nil {
+		return err
+	}
+	adsRepo := repo.NewAdsRepository(postgres, repo.Guards{})
+
+	var adIDs []string
+	if err := postgres.Model(&model.Ad{}).Limit(50).Pluck("id", &adIDs).Error; err != nil {
+		return fmt.Errorf("failed to load ads: %w", err)
+	}
+	if len(adIDs) == 0 {
+		return errors.New("no ads found; run the seeder first")
+	}
+
+	var results []benchResult
+	for _, name := range strings.Split(*writers, ",") {
+		writer, err := repo.NewClickWriter(adsRepo, strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+
+		clicks := benchClicks(*rows, adIDs)
+		result := benchResult{writer: writer.Name(), rows: len(clicks)}
+
+		start := time.Now()
+		for i := 0; i < len(clicks); i += *batch {
+			end := i + *batch
+			if end > len(clicks) {
+				end = len(clicks)
+			}
+
+			batchStart := time.Now()
+			ids, err := writer.WriteClicks(context.Background(), clicks[i:end])
+			if err != nil {
+				return fmt.Errorf("%s writer failed: %w", writer.Name(), err)
+			}
+			result.batches = append(result.batches, time.Since(batchStart))
+			result.inserted += len(ids)
+		}
+		result.elapsed = time.Since(start)
+		results = append(results, result)
+
+		if !*keep {
+			if err := removeBenchClicks(postgres, clicks); err != nil {
+				return fmt.Errorf("failed to clean up benchmark rows: %w", err)
+			}
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WRITER\tROWS\tINSERTED\tELAPSED\tROWS/S\tBATCH P50\tBATCH P99")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.0f\t%s\t%s\n",
+			r.writer, r.rows, r.inserted, r.elapsed.Round(time.Millisecond),
+			float64(r.inserted)/r.elapsed.Seconds(),
+			percentile(r.batches, 0.50).Round(time.Microsecond),
+			percentile(r.batches, 0.99).Round(time.Microsecond))
+	}
+	return w.Flush()
+}
+
+func benchClicks(n int, adIDs []string) []model.Clicks {
+	now := time.Now().UTC()
+	clicks := make([]model.Clicks, n)
+	for i := range clicks {
+		clicks[i] = model.Clicks{
+			ID:            uuid.New().String(),
+			AdID:          adIDs[i%len(adIDs)],
+			IP:            fmt.Sprintf("198.51.100.%d", i%256),
+			VideoPlayTime: i % 300,
+			Timestamp:     now.Add(-time.Duration(i) * time.Millisecond),
+		}
+	}
+	return clicks
+}
+
+// removeBenchClicks deletes benchmark rows and takes their increments back off the counters
+func removeBenchClicks(postgres *gorm.DB, clicks []model.Clicks) error {
+	return postgres.Transaction(func(tx *gorm.DB) error {
+		perAd := make(map[string]int)
+		for i := 0; i < len(clicks); i += 1000 {
+			end := i + 1000
+			if end > len(clicks) {
+				end = len(clicks)
+			}
+
+			ids := make([]string, 0, end-i)
+			for _, c := range clicks[i:end] {
+				ids = append(ids, c.ID)
+			}
+
+			var adIDs []string
+			if err := tx.Raw("DELETE FROM clicks WHERE id IN ? RETURNING ad_id", ids).Scan(&adIDs).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM click_ids WHERE id IN ?", ids).Error; err != nil {
+				return err
+			}
+			for _, adID := range adIDs {
+				perAd[adID]++
+			}
+		}
+
+		for adID, n := range perAd {
+			err := tx.Model(&model.Ad{}).
+				Where("id = ?", adID).
+				UpdateColumn("total_clicks", gorm.Expr("total_clicks - ?", n)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))]
+}
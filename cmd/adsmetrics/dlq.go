@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+)
+
+// runDLQ inspects and replays clicks_quarantine, where the batch writer parks
+// clicks that failed with a permanent error
+func runDLQ(args []string) error {
+	fs := flag.NewFlagSet("dlq", flag.ExitOnError)
+	adID := fs.String("ad", "", "only clicks of this ad")
+	limit := fs.Int("limit", 10000, "maximum number of quarantined clicks to list or replay")
+	batch := fs.Int("batch", 500, "clicks written per batch (replay only)")
+	dryRun := fs.Bool("dry-run", false, "show what would be replayed without writing anything (replay only)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: adsmetrics dlq <list|replay> [flags]")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing dlq action")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *limit < 1 || *batch < 1 {
+		return errors.New("-limit and -batch must be positive")
+	}
+
+	cfg := config.NewConfig()
+	postgres, err := db.ConnectPostgreSQL(cfg)
+	if err != nil {
+		return err
+	}
+	adsRepo := repo.NewAdsRepository(postgres, repo.Guards{})
+	ctx := context.Background()
+
+	quarantined, err := adsRepo.GetQuarantinedClicks(ctx, *adID, *limit)
+	if err != nil {
+		return fmt.Errorf("failed to load quarantined clicks: %w", err)
+	}
+
+	switch action {
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tAD ID\tTIMESTAMP\tQUARANTINED AT\tERROR")
+		for _, q := range quarantined {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", q.ID, q.AdID, q.Timestamp.Format(time.RFC3339), q.QuarantinedAt.Format(time.RFC3339), q.Error)
+		}
+		return w.Flush()
+
+	case "replay":
+		if *dryRun {
+			fmt.Printf("would replay %d quarantined clicks\n", len(quarantined))
+			return nil
+		}
+		writer, err := repo.NewClickWriter(adsRepo, cfg.ClickWriter)
+		if err != nil {
+			return err
+		}
+		return replayQuarantine(ctx, adsRepo, writer, quarantined, *batch)
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown dlq action %q", action)
+	}
+}
+
+// replayQuarantine writes quarantined clicks back through the click writer,
+// so ad counters are bumped as usual, and releases the ones that made it. A
+// batch that fails permanently is retried click by click; clicks that still
+// fail stay quarantined. Replaying twice is safe: the writer skips clicks
+// that already exist.
+func replayQuarantine(ctx context.Context, adsRepo *repo.AdsRepository, writer repo.ClickWriter, quarantined []repo.QuarantinedClick, batchSize int) error {
+	var replayed, inserted, failed int
+
+	for i := 0; i < len(quarantined); i += batchSize {
+		end := min(i+batchSize, len(quarantined))
+		clicks := make([]model.Clicks, 0, end-i)
+		for _, q := range quarantined[i:end] {
+			clicks = append(clicks, q.Clicks)
+		}
+
+		written := clicks
+		ids, err := writer.WriteClicks(ctx, clicks)
+		n := len(ids)
+		if err != nil {
+			if repo.IsTransientError(err) {
+				return fmt.Errorf("replay stopped after %d clicks: %w", replayed, err)
+			}
+
+			written = nil
+			n = 0
+			for _, c := range clicks {
+				ids, err := writer.WriteClicks(ctx, []model.Clicks{c})
+				if err != nil {
+					if repo.IsTransientError(err) {
+						return fmt.Errorf("replay stopped after %d clicks: %w", replayed, err)
+					}
+					failed++
+					fmt.Fprintf(os.Stderr, "click %s still fails: %v\n", c.ID, err)
+					continue
+				}
+				written = append(written, c)
+				n += len(ids)
+			}
+		}
+
+		if err := adsRepo.ReleaseQuarantinedClicks(ctx, written); err != nil {
+			return fmt.Errorf("failed to release replayed clicks: %w", err)
+		}
+		replayed += len(written)
+		inserted += n
+	}
+
+	fmt.Printf("replayed %d clicks (%d new, %d already stored), %d still failing\n",
+		replayed, inserted, replayed-inserted, failed)
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+)
+
+// Exported rows; the models' relations are left out
+type adRecord struct {
+	ID          string    `json:"id"`
+	ImageURL    string    `json:"image_url"`
+	TargetURL   string    `json:"target_url"`
+	TotalClicks int       `json:"total_clicks"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type clickRecord struct {
+	ID           string    `json:"id"`
+	AdID         string    `json:"ad_id"`
+	IP           string    `json:"ip"`
+	PlaybackTime int       `json:"playback_time"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// recordWriter writes export rows as CSV or JSON lines
+type recordWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newRecordWriter(w io.Writer, format string, header []string) (*recordWriter, error) {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &recordWriter{csv: cw}, nil
+	case "jsonl":
+		return &recordWriter{json: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (csv|jsonl)", format)
+	}
+}
+
+func (w *recordWriter) write(v interface{}, fields []string) error {
+	if w.csv != nil {
+		return w.csv.Write(fields)
+	}
+	return w.json.Encode(v)
+}
+
+func (w *recordWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "csv", "output format: csv or jsonl")
+	out := fs.String("o", "", "output file (default stdout)")
+	adID := fs.String("ad", "", "only clicks of this ad (clicks only)")
+	since := fs.Duration("since", 24*time.Hour, "export clicks newer than this (clicks only)")
+	from := fs.String("from", "", "RFC 3339 start of the click range, overrides -since (clicks only)")
+	to := fs.String("to", "", "RFC 3339 end of the click range (default now, clicks only)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: adsmetrics export <ads|clicks> [flags]")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing export target")
+	}
+	target := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	end := time.Now()
+	if *to != "" {
+		t, err := time.Parse(time.RFC3339, *to)
+		if err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+		end = t
+	}
+	start := end.Add(-*since)
+	if *from != "" {
+		t, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+		start = t
+	}
+
+	var dst io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dst = f
+	}
+	buf := bufio.NewWriter(dst)
+
+	cfg := config.NewConfig()
+	postgres, err := db.ConnectPostgreSQL(cfg)
+	if err != nil {
+		return err
+	}
+	adsRepo := repo.NewAdsRepository(postgres, repo.Guards{})
+	ctx := context.Background()
+
+	var rows int
+	switch target {
+	case "ads":
+		w, err := newRecordWriter(buf, *format, []string{"id", "image_url", "target_url", "total_clicks", "created_at"})
+		if err != nil {
+			return err
+		}
+		var ads []model.Ad
+		if err := postgres.WithContext(ctx).Order("id").Find(&ads).Error; err != nil {
+			return fmt.Errorf("failed to load ads: %w", err)
+		}
+		for _, ad := range ads {
+			record := adRecord{ad.ID, ad.ImageURL, ad.TargetURL, ad.TotalClicks, ad.CreatedAt}
+			fields := []string{ad.ID, ad.ImageURL, ad.TargetURL, strconv.Itoa(ad.TotalClicks), ad.CreatedAt.Format(time.RFC3339)}
+			if err := w.write(record, fields); err != nil {
+				return err
+			}
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+		rows = len(ads)
+
+	case "clicks":
+		w, err := newRecordWriter(buf, *format, []string{"id", "ad_id", "ip", "playback_time", "timestamp"})
+		if err != nil {
+			return err
+		}
+		err = adsRepo.EachClick(ctx, *adID, start, end, func(c model.Clicks) error {
+			rows++
+			record := clickRecord{c.ID, c.AdID, c.IP, c.VideoPlayTime, c.Timestamp}
+			fields := []string{c.ID, c.AdID, c.IP, strconv.Itoa(c.VideoPlayTime), c.Timestamp.Format(time.RFC3339Nano)}
+			return w.write(record, fields)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export clicks: %w", err)
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown export target %q", target)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d %s\n", rows, target)
+	return nil
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/handlers"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/seed"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/services"
+	"gorm.io/gorm"
+)
+
+// clickSender delivers one click and returns the ID it will be stored under
+type clickSender interface {
+	send(ctx context.Context, click model.Clicks) (id string, err error)
+}
+
+// httpSender posts clicks to POST /ads/click
+type httpSender struct {
+	client *http.Client
+	url    string
+}
+
+// statusError is a non-2xx response
+type statusError int
+
+func (e statusError) Error() string { return "HTTP " + strconv.Itoa(int(e)) }
+
+func (s *httpSender) send(ctx context.Context, click model.Clicks) (string, error) {
+	body, err := json.Marshal(handlers.ClickRequest{
+		AdID:          click.AdID,
+		IP:            click.IP,
+		VideoPlayTime: click.VideoPlayTime,
+		Timestamp:     click.Timestamp,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", statusError(resp.StatusCode)
+	}
+	var accepted struct {
+		ClickID string `json:"click_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+		return "", fmt.Errorf("invalid response: %w", err)
+	}
+	return accepted.ClickID, nil
+}
+
+// natsSender publishes clicks straight onto the click subject, bypassing the API
+type natsSender struct {
+	conn *nats.Conn
+}
+
+func (s *natsSender) send(ctx context.Context, click model.Clicks) (string, error) {
+	data, err := json.Marshal(click)
+	if err != nil {
+		return "", err
+	}
+
+	// Stamped like the API does, so the consumers' stage latencies cover it
+	msg := nats.NewMsg(services.ClickSubject)
+	msg.Data = data
+	now := time.Now().Format(time.RFC3339Nano)
+	msg.Header.Set(services.HeaderIngestedAt, now)
+	msg.Header.Set(services.HeaderPublishedAt, now)
+	return click.ID, s.conn.PublishMsg(msg)
+}
+
+// loadStats collects the outcome of every click sent
+type loadStats struct {
+	mu        sync.Mutex
+	kinds     map[seed.ClickKind]int
+	succeeded int
+	failures  map[string]int
+	skipped   int
+	latencies []time.Duration
+}
+
+func (s *loadStats) record(kind seed.ClickKind, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kinds[kind]++
+	s.latencies = append(s.latencies, latency)
+	if err == nil {
+		s.succeeded++
+		return
+	}
+
+	reason := "error"
+	var status statusError
+	if errors.As(err, &status) {
+		reason = strconv.Itoa(int(status))
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		reason = "timeout"
+	}
+	s.failures[reason]++
+}
+
+// lagTracker polls Postgres for sampled clicks and records how long after
+// being sent each one was persisted
+type lagTracker struct {
+	postgres *gorm.DB
+	since    time.Time
+
+	mu      sync.Mutex
+	pending map[string]time.Time // click ID -> sent at
+	lags    []time.Duration
+}
+
+func (t *lagTracker) add(id string, sentAt time.Time) {
+	t.mu.Lock()
+	t.pending[id] = sentAt
+	t.mu.Unlock()
+}
+
+// poll checks every pending click once and reports how many are still pending
+func (t *lagTracker) poll(ctx context.Context) (int, error) {
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.pending))
+	for id := range t.pending {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+
+	for start := 0; start < len(ids); start += 1000 {
+		end := min(start+1000, len(ids))
+		var found []string
+		err := t.postgres.WithContext(ctx).Model(&model.Clicks{}).
+			Where("id IN ? AND timestamp >= ?", ids[start:end], t.since).
+			Pluck("id", &found).Error
+		if err != nil {
+			return 0, err
+		}
+
+		now := time.Now()
+		t.mu.Lock()
+		for _, id := range found {
+			if sentAt, ok := t.pending[id]; ok {
+				t.lags = append(t.lags, now.Sub(sentAt))
+				delete(t.pending, id)
+			}
+		}
+		t.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending), nil
+}
+
+// run polls until ctx is done
+func (t *lagTracker) run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := t.poll(ctx); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "persistence check failed: %v\n", err)
+			}
+		}
+	}
+}
+
+type loadJob struct {
+	click  model.Clicks
+	kind   seed.ClickKind
+	sample bool
+}
+
+// runLoadgen replays the sample data's traffic shape against the API or NATS
+func runLoadgen(args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	target := fs.String("target", "http", "where clicks go: http (POST /ads/click) or nats (the click subject)")
+	baseURL := fs.String("url", "http://localhost:8080", "API base URL (http target)")
+	natsURL := fs.String("nats-url", "", "NATS URL (nats target, default NATS_URL)")
+	rps := fs.Float64("rps", 100, "average clicks per second")
+	duration := fs.Duration("duration", time.Minute, "how long to send")
+	concurrency := fs.Int("concurrency", 64, "clicks in flight at most")
+	adList := fs.String("ads", "", "comma separated ad IDs (default every ad in the database)")
+	dupRate := fs.Float64("dup-rate", 0.02, "share of clicks resent as exact duplicates (nats target only)")
+	botRate := fs.Float64("bot-rate", 0.05, "share of clicks from a small pool of bot IPs")
+	day := fs.Duration("day", 0, "length of a simulated day: the rate follows the peak-hour profile (0 keeps it flat)")
+	lagSamples := fs.Float64("lag-samples", 0.01, "share of organic clicks tracked until persisted (0 disables)")
+	lagTimeout := fs.Duration("lag-timeout", 30*time.Second, "how long to wait for tracked clicks after sending stops")
+	randSeed := fs.Int64("rand-seed", 0, "RNG seed for the traffic (default SEED_RANDOM_SEED)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// POST /ads/click takes no click ID, so the API can't tell a resent click
+	// from a new one; only NATS messages carry the ID that makes it a duplicate
+	if *target == "http" {
+		if flagSet(fs, "dup-rate") && *dupRate > 0 {
+			return errors.New("-dup-rate needs -target nats: the API has no click ID to recognise a duplicate by")
+		}
+		*dupRate = 0
+	}
+
+	switch {
+	case *rps <= 0 || *duration <= 0 || *concurrency < 1:
+		return errors.New("-rps, -duration and -concurrency must be positive")
+	case *dupRate < 0 || *botRate < 0 || *dupRate+*botRate > 1:
+		return errors.New("-dup-rate and -bot-rate must be between 0 and 1 together")
+	case *lagSamples < 0 || *lagSamples > 1:
+		return errors.New("-lag-samples must be between 0 and 1")
+	}
+
+	cfg := config.NewConfig()
+	if *randSeed == 0 {
+		*randSeed = cfg.SeedRandomSeed
+	}
+
+	var adIDs []string
+	if *adList != "" {
+		adIDs = strings.Split(*adList, ",")
+	}
+
+	var postgres *gorm.DB
+	if len(adIDs) == 0 || *lagSamples > 0 {
+		var err error
+		if postgres, err = db.ConnectPostgreSQL(cfg); err != nil {
+			return err
+		}
+	}
+	if len(adIDs) == 0 {
+		if err := postgres.Model(&model.Ad{}).Order("id").Pluck("id", &adIDs).Error; err != nil {
+			return fmt.Errorf("failed to load ads: %w", err)
+		}
+		if len(adIDs) == 0 {
+			return errors.New("no ads found; run the seeder first or pass -ads")
+		}
+	}
+
+	var sender clickSender
+	var destination string
+	switch *target {
+	case "http":
+		destination = strings.TrimRight(*baseURL, "/") + "/ads/click"
+		sender = &httpSender{
+			url: destination,
+			client: &http.Client{
+				Timeout:   10 * time.Second,
+				Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency},
+			},
+		}
+	case "nats":
+		if *natsURL == "" {
+			*natsURL = cfg.NATSURL
+		}
+		conn, err := nats.Connect(*natsURL)
+		if err != nil {
+			return fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+		defer conn.Close()
+		destination = *natsURL + " " + services.ClickSubject
+		sender = &natsSender{conn: conn}
+	default:
+		return fmt.Errorf("unknown target %q (http|nats)", *target)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stats := &loadStats{kinds: map[seed.ClickKind]int{}, failures: map[string]int{}}
+	start := time.Now()
+	tracker := &lagTracker{postgres: postgres, since: start.Add(-time.Minute), pending: map[string]time.Time{}}
+	trackCtx, stopTracking := context.WithCancel(ctx)
+	defer stopTracking()
+	if *lagSamples > 0 {
+		go tracker.run(trackCtx, 250*time.Millisecond)
+	}
+
+	// Workers send; the pacer below never waits for them, so a slow target
+	// shows up as skipped clicks rather than a quietly lower rate
+	jobs := make(chan loadJob, *concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				sentAt := time.Now()
+				id, err := sender.send(ctx, job.click)
+				stats.record(job.kind, time.Since(sentAt), err)
+				if err == nil && job.sample && id != "" {
+					tracker.add(id, sentAt)
+				}
+			}
+		}()
+	}
+
+	fmt.Fprintf(os.Stderr, "sending %.0f clicks/s to %s for %s across %d ads\n", *rps, destination, *duration, len(adIDs))
+	traffic := seed.NewTraffic(adIDs, *dupRate, *botRate, *randSeed)
+	sampleEvery := 0
+	if *lagSamples > 0 {
+		sampleEvery = int(1 / *lagSamples)
+	}
+
+	var organic int
+	next := start
+	for ctx.Err() == nil {
+		elapsed := time.Since(start)
+		if elapsed >= *duration {
+			break
+		}
+
+		rate := *rps
+		if *day > 0 {
+			hour := int(elapsed%*day) * 24 / int(*day)
+			rate *= seed.HourWeight(hour)
+		}
+		next = next.Add(time.Duration(float64(time.Second) / rate))
+		if wait := time.Until(next); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+
+		click, kind := traffic.Next(time.Now())
+		job := loadJob{click: click, kind: kind}
+		if kind == seed.ClickOrganic {
+			organic++
+			job.sample = sampleEvery > 0 && organic%sampleEvery == 0
+		}
+
+		select {
+		case jobs <- job:
+		default:
+			stats.mu.Lock()
+			stats.skipped++
+			stats.mu.Unlock()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	sendTime := time.Since(start)
+
+	// Give the pipeline time to persist the tracked clicks
+	var unpersisted int
+	if *lagSamples > 0 {
+		stopTracking()
+		deadline := time.Now().Add(*lagTimeout)
+		for {
+			var err error
+			if unpersisted, err = tracker.poll(ctx); err != nil {
+				return fmt.Errorf("persistence check failed: %w", err)
+			}
+			if unpersisted == 0 || time.Now().After(deadline) || ctx.Err() != nil {
+				break
+			}
+			time.Sleep(250 * time.Millisecond)
+		}
+	}
+
+	return printLoadReport(stats, tracker, destination, sendTime, unpersisted)
+}
+
+func printLoadReport(stats *loadStats, tracker *lagTracker, destination string, elapsed time.Duration, unpersisted int) error {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	sent := len(stats.latencies)
+	perSecond := func(n int) float64 { return float64(n) / elapsed.Seconds() }
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "target\t%s\n", destination)
+	fmt.Fprintf(w, "duration\t%s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "sent\t%d (%.1f/s): %d organic, %d duplicate, %d bot\n", sent, perSecond(sent),
+		stats.kinds[seed.ClickOrganic], stats.kinds[seed.ClickDuplicate], stats.kinds[seed.ClickBot])
+	fmt.Fprintf(w, "succeeded\t%d (%.1f/s)\n", stats.succeeded, perSecond(stats.succeeded))
+
+	reasons := make([]string, 0, len(stats.failures))
+	for reason, n := range stats.failures {
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, n))
+	}
+	sort.Strings(reasons)
+	fmt.Fprintf(w, "failed\t%d %v\n", sent-stats.succeeded, reasons)
+	fmt.Fprintf(w, "skipped\t%d (all workers busy)\n", stats.skipped)
+	fmt.Fprintf(w, "latency\tp50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(stats.latencies, 0.50).Round(time.Microsecond),
+		percentile(stats.latencies, 0.90).Round(time.Microsecond),
+		percentile(stats.latencies, 0.99).Round(time.Microsecond),
+		percentile(stats.latencies, 1).Round(time.Microsecond))
+
+	tracker.mu.Lock()
+	lags := tracker.lags
+	tracker.mu.Unlock()
+	if len(lags) > 0 || unpersisted > 0 {
+		fmt.Fprintf(w, "persistence lag\tp50 %s  p90 %s  p99 %s  max %s (%d tracked, %d not persisted)\n",
+			percentile(lags, 0.50).Round(time.Millisecond),
+			percentile(lags, 0.90).Round(time.Millisecond),
+			percentile(lags, 0.99).Round(time.Millisecond),
+			percentile(lags, 1).Round(time.Millisecond),
+			len(lags)+unpersisted, unpersisted)
+	}
+	return w.Flush()
+}
+
+// flagSet reports whether name was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,56 @@
+// Command adsmetrics is the operational CLI for the ads metric tracker. It
+// shares configuration loading with the API server, so operational tasks
+// don't need raw SQL.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{name: "migrate", summary: "Apply, roll back or inspect schema migrations", run: runMigrate},
+	{name: "reconcile", summary: "Report (and optionally fix) Ad.TotalClicks drift", run: runReconcile},
+	{name: "seed", summary: "Seed sample ads and clicks (or minimal test data)", run: runSeed},
+	{name: "export", summary: "Export ads or clicks as CSV or JSON lines", run: runExport},
+	{name: "dlq", summary: "List or replay quarantined clicks", run: runDLQ},
+	{name: "apikey", summary: "Create, revoke or list API keys", run: runAPIKey},
+	{name: "ads", summary: "Import ads from a CSV or JSON file", run: runAds},
+	{name: "bench-writer", summary: "Compare click batch writers (INSERT vs COPY) against a database", run: runBenchWriter},
+	{name: "loadgen", summary: "Send synthetic click traffic and report throughput and latency", run: runLoadgen},
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "adsmetrics %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "adsmetrics: unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: adsmetrics <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/services"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
+)
+
+func runReconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "overwrite drifted counters with the recomputed totals")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := config.NewConfig()
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		return err
+	}
+
+	postgres, err := db.ConnectPostgreSQL(cfg)
+	if err != nil {
+		return err
+	}
+
+	reconciler := services.NewReconcileService(repo.NewAdsRepository(postgres, repo.Guards{}), cfg.ClicksRetentionDays, log)
+	report, err := reconciler.Reconcile(context.Background(), *fix)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AD ID\tCOUNTER\tACTUAL\tDRIFT\tFIXED")
+	for _, d := range report.Drifts {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%+d\t%t\n", d.AdID, d.Counter, d.Actual, d.Drift, d.Fixed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nchecked %d ads, %d drifted (total drift %d), %d fixed in %s\n",
+		report.CheckedAds, report.DriftedAds, report.TotalDrift, report.FixedAds, report.Duration)
+	return nil
+}
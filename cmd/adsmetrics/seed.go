@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/seed"
+)
+
+func runSeed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	test := fs.Bool("test", false, "seed the three minimal test ads instead of the sample catalog")
+	ads := fs.Int("ads", 0, "number of catalog ads to seed (0 for all of them)")
+	days := fs.Int("days", 30, "days of sample click history per ad")
+	randSeed := fs.Int64("rand-seed", 0, "RNG seed for the generated data (default SEED_RANDOM_SEED)")
+	until := fs.String("until", "", "RFC 3339 end of the click history (default start of today, UTC)")
+	force := fs.Bool("force", false, "seed even when APP_ENV=prod")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *ads < 0 || *days < 0 {
+		return errors.New("-ads and -days must not be negative")
+	}
+
+	cfg := config.NewConfig()
+	if cfg.AppEnv == config.EnvProd && !*force {
+		return errors.New("refusing to seed with APP_ENV=prod (use -force if you really mean it)")
+	}
+	if *randSeed == 0 {
+		*randSeed = cfg.SeedRandomSeed
+	}
+
+	postgres, err := db.ConnectPostgreSQL(cfg)
+	if err != nil {
+		return err
+	}
+
+	seeder := seed.NewSeeder(postgres, *randSeed)
+	if *until != "" {
+		t, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+		seeder.Until = t
+	}
+	if *test {
+		return seeder.SeedTestData()
+	}
+	seeder.AdLimit = *ads
+	seeder.HistoryDays = *days
+	return seeder.SeedAll()
+}
@@ -2,15 +2,11 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
-	"github.com/ratheeshkumar25/adsmetrictracker/config"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/di"
 )
 
@@ -45,40 +41,22 @@ import (
 // @externalDocs.description	OpenAPI
 // @externalDocs.url			https://swagger.io/resources/open-api/
 func main() {
-	// Initialize the server using the new DI format
-	router, err := di.Init()
-	if err != nil {
-		log.Fatalf("Failed to initialize application: %v", err)
+	// The run mode comes from the first argument, or RUN_MODE when there is none
+	var mode string
+	if len(os.Args) > 1 {
+		mode = os.Args[1]
 	}
 
-	// Get configuration for server setup
-	cfg := config.NewConfig()
-
-	// Create HTTP server
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%s", cfg.HttpPort),
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	app, err := di.New(mode)
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
 	}
 
-	// Graceful server shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-quit
-		log.Println("Shutting down server...")
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := server.Shutdown(ctx); err != nil {
-			log.Fatalf("Server shutdown failed: %v", err)
-		}
-		log.Println("Server gracefully stopped")
-	}()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	log.Printf("Server starting on %s", server.Addr)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := app.Run(ctx); err != nil {
+		log.Fatalf("Application stopped with error: %v", err)
 	}
+	log.Println("Server gracefully stopped")
 }
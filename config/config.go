@@ -3,13 +3,74 @@ package config
 import (
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// Run modes: which components a process runs
+const (
+	RunModeAll      = "all"       // HTTP API and click consumers
+	RunModeServeAPI = "serve-api" // HTTP API only, clicks are published to NATS
+	RunModeConsume  = "consume"   // NATS click consumers only
+)
+
+// ValidRunMode reports whether mode is one of the run modes
+func ValidRunMode(mode string) bool {
+	switch mode {
+	case RunModeAll, RunModeServeAPI, RunModeConsume:
+		return true
+	}
+	return false
+}
+
+// Environment profiles (APP_ENV)
+const (
+	EnvDev  = "dev"
+	EnvTest = "test"
+	EnvProd = "prod"
+)
+
+// Seed modes: what is seeded into an empty database at startup
+const (
+	SeedModeOff    = "off"
+	SeedModeSample = "sample" // the demo catalog with generated click history
+	SeedModeTest   = "test"   // a few minimal test ads
+)
+
+// Trace exporters (OTEL_EXPORTER)
+const (
+	TraceExporterNone   = "none"   // tracing disabled
+	TraceExporterOTLP   = "otlp"   // OTLP over HTTP to OTEL_EXPORTER_OTLP_ENDPOINT
+	TraceExporterStdout = "stdout" // pretty-printed spans, for local testing
+)
+
+// Log outputs (LOG_OUTPUT) and encodings (LOG_ENCODING)
+const (
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file" // LOG_FILE, rotated by size
+	LogOutputBoth   = "both"
+
+	LogEncodingJSON    = "json"
+	LogEncodingConsole = "console"
+)
+
+// defaultSeedModes is the seed mode each profile gets when SEED_MODE is unset
+var defaultSeedModes = map[string]string{
+	EnvDev:  SeedModeSample,
+	EnvTest: SeedModeTest,
+	EnvProd: SeedModeOff,
+}
+
 type Config struct {
+	// Environment profile: dev, test or prod
+	AppEnv string `mapstructure:"APP_ENV"`
+
 	HttpHost         string `mapstructure:"HTTP_HOST"`
 	HttpPort         string `mapstructure:"HTTP_PORT"`
+	AdminHost        string `mapstructure:"ADMIN_HOST"`
+	AdminPort        string `mapstructure:"ADMIN_PORT"`
 	LogFile          string `mapstructure:"LOG_FILE"`
 	NATSURL          string `mapstructure:"NATS_URL"`
 	PostgresHost     string `mapstructure:"POSTGRES_HOST"`
@@ -21,6 +82,107 @@ type Config struct {
 	RedisPort        string `mapstructure:"REDIS_PORT"`
 	RedisPassword    string `mapstructure:"REDIS_PASSWORD"`
 	RedisDB          int    `mapstructure:"REDIS_DB"`
+
+	// Logging; LOG_LEVEL can be changed at runtime through /admin/log-level
+	LogLevel              string `mapstructure:"LOG_LEVEL"`
+	LogOutput             string `mapstructure:"LOG_OUTPUT"`
+	LogEncoding           string `mapstructure:"LOG_ENCODING"`
+	LogMaxSizeMB          int    `mapstructure:"LOG_MAX_SIZE_MB"`
+	LogMaxBackups         int    `mapstructure:"LOG_MAX_BACKUPS"`
+	LogMaxAgeDays         int    `mapstructure:"LOG_MAX_AGE_DAYS"`
+	LogSamplingInitial    int    `mapstructure:"LOG_SAMPLING_INITIAL"`
+	LogSamplingThereafter int    `mapstructure:"LOG_SAMPLING_THEREAFTER"`
+
+	// Startup seeding, never allowed in prod; a fixed RNG seed keeps fixtures reproducible
+	SeedMode       string `mapstructure:"SEED_MODE"`
+	SeedRandomSeed int64  `mapstructure:"SEED_RANDOM_SEED"`
+
+	// Process role and NATS consumer workers; serve-api nodes only write
+	// clicks to Postgres themselves when NATS fails if fallback writes are on
+	RunMode                string `mapstructure:"RUN_MODE"`
+	NATSConsumerWorkers    int    `mapstructure:"NATS_CONSUMER_WORKERS"`
+	ServeAPIFallbackWrites bool   `mapstructure:"SERVE_API_FALLBACK_WRITES"`
+
+	// Schema migrations: auto, check or off
+	MigrationMode string `mapstructure:"MIGRATION_MODE"`
+
+	// Clicks table partitioning
+	ClicksPartitionInterval string `mapstructure:"CLICKS_PARTITION_INTERVAL"`
+	ClicksPartitionPremake  int    `mapstructure:"CLICKS_PARTITION_PREMAKE"`
+	ClicksRetentionDays     int    `mapstructure:"CLICKS_RETENTION_DAYS"`
+
+	// Click batch writer: insert or copy
+	ClickWriter string `mapstructure:"CLICK_WRITER"`
+
+	// Click batching
+	BatchMinSize             int           `mapstructure:"BATCH_MIN_SIZE"`
+	BatchMaxSize             int           `mapstructure:"BATCH_MAX_SIZE"`
+	BatchMaxBytes            int           `mapstructure:"BATCH_MAX_BYTES"`
+	BatchMinLatency          time.Duration `mapstructure:"BATCH_MIN_LATENCY"`
+	BatchMaxLatency          time.Duration `mapstructure:"BATCH_MAX_LATENCY"`
+	BatchAdaptive            bool          `mapstructure:"BATCH_ADAPTIVE"`
+	BatchTargetInsertLatency time.Duration `mapstructure:"BATCH_TARGET_INSERT_LATENCY"`
+	BatchQueueSize           int           `mapstructure:"BATCH_QUEUE_SIZE"`
+	BatchRetryBaseDelay      time.Duration `mapstructure:"BATCH_RETRY_BASE_DELAY"`
+	BatchRetryMaxDelay       time.Duration `mapstructure:"BATCH_RETRY_MAX_DELAY"`
+
+	// Circuit breakers (shared by every dependency's breaker)
+	BreakerWindow            time.Duration `mapstructure:"BREAKER_WINDOW"`
+	BreakerWindowCalls       int           `mapstructure:"BREAKER_WINDOW_CALLS"`
+	BreakerMinRequests       int           `mapstructure:"BREAKER_MIN_REQUESTS"`
+	BreakerFailureRate       float64       `mapstructure:"BREAKER_FAILURE_RATE"`
+	BreakerSlowCallThreshold time.Duration `mapstructure:"BREAKER_SLOW_CALL_THRESHOLD"`
+	BreakerSlowCallRate      float64       `mapstructure:"BREAKER_SLOW_CALL_RATE"`
+	BreakerOpenTimeout       time.Duration `mapstructure:"BREAKER_OPEN_TIMEOUT"`
+	BreakerHalfOpenMaxCalls  int           `mapstructure:"BREAKER_HALF_OPEN_MAX_CALLS"`
+
+	// Fallbacks while Postgres is unavailable
+	SpoolDir          string        `mapstructure:"SPOOL_DIR"`
+	SpoolMaxBytes     int64         `mapstructure:"SPOOL_MAX_BYTES"`
+	AnalyticsCacheTTL time.Duration `mapstructure:"ANALYTICS_CACHE_TTL"`
+
+	// Bulkheads: Postgres pool split between ingestion writes and analytics
+	// reads, and concurrency caps per HTTP route group
+	PostgresMaxOpenConns     int           `mapstructure:"POSTGRES_MAX_OPEN_CONNS"`
+	PostgresMaxIdleConns     int           `mapstructure:"POSTGRES_MAX_IDLE_CONNS"`
+	DBWriteConcurrency       int           `mapstructure:"DB_WRITE_CONCURRENCY"`
+	DBReadConcurrency        int           `mapstructure:"DB_READ_CONCURRENCY"`
+	DBQueueTimeout           time.Duration `mapstructure:"DB_QUEUE_TIMEOUT"`
+	HTTPIngestConcurrency    int           `mapstructure:"HTTP_INGEST_CONCURRENCY"`
+	HTTPAnalyticsConcurrency int           `mapstructure:"HTTP_ANALYTICS_CONCURRENCY"`
+	HTTPQueueTimeout         time.Duration `mapstructure:"HTTP_QUEUE_TIMEOUT"`
+
+	// Per-operation timeouts
+	HTTPRequestTimeout time.Duration `mapstructure:"HTTP_REQUEST_TIMEOUT"`
+	DBQueryTimeout     time.Duration `mapstructure:"DB_QUERY_TIMEOUT"`
+	DBBatchTimeout     time.Duration `mapstructure:"DB_BATCH_TIMEOUT"`
+
+	// Health checks
+	HealthCheckTimeout       time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	HealthCacheTTL           time.Duration `mapstructure:"HEALTH_CACHE_TTL"`
+	HealthMaxReplicationLag  time.Duration `mapstructure:"HEALTH_MAX_REPLICATION_LAG"`
+	HealthMaxBatchBacklog    float64       `mapstructure:"HEALTH_MAX_BATCH_BACKLOG"`
+	HealthWriterStallTimeout time.Duration `mapstructure:"HEALTH_WRITER_STALL_TIMEOUT"`
+
+	// Graceful shutdown
+	ShutdownTimeout    time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+
+	// Bound on ad_id series of ad_clicks_total: these ads plus the top K
+	// others by recent clicks; the rest are counted as "other"
+	MetricsAdLabelTopK      int           `mapstructure:"METRICS_AD_LABEL_TOP_K"`
+	MetricsAdLabelAllowlist []string      `mapstructure:"METRICS_AD_LABEL_ALLOWLIST"`
+	MetricsAdLabelRefresh   time.Duration `mapstructure:"METRICS_AD_LABEL_REFRESH"`
+
+	// OpenTelemetry tracing
+	OTELExporter    string  `mapstructure:"OTEL_EXPORTER"`
+	OTELEndpoint    string  `mapstructure:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTELServiceName string  `mapstructure:"OTEL_SERVICE_NAME"`
+	OTELSampleRatio float64 `mapstructure:"OTEL_TRACES_SAMPLE_RATIO"`
+
+	// Ad.TotalClicks reconciliation
+	ReconcileInterval time.Duration `mapstructure:"RECONCILE_INTERVAL"`
+	ReconcileAutoFix  bool          `mapstructure:"RECONCILE_AUTO_FIX"`
 }
 
 func NewConfig() *Config {
@@ -34,12 +196,84 @@ func NewConfig() *Config {
 		log.Printf("Warning: Could not read .env file: %v", err)
 	}
 
+	// A deployment that forgets APP_ENV must not seed demo data
+	viper.SetDefault("APP_ENV", EnvProd)
+	viper.SetDefault("SEED_RANDOM_SEED", 42)
 	viper.SetDefault("HTTP_PORT", "8080")
+	viper.SetDefault("ADMIN_HOST", "127.0.0.1")
+	viper.SetDefault("ADMIN_PORT", "8081")
 	viper.SetDefault("LOG_FILE", "app.log")
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("LOG_OUTPUT", LogOutputBoth)
+	viper.SetDefault("LOG_ENCODING", LogEncodingJSON)
+	viper.SetDefault("LOG_MAX_SIZE_MB", 100)
+	viper.SetDefault("LOG_MAX_BACKUPS", 30)
+	viper.SetDefault("LOG_MAX_AGE_DAYS", 30)
+	viper.SetDefault("LOG_SAMPLING_INITIAL", 100)
+	viper.SetDefault("LOG_SAMPLING_THEREAFTER", 100)
+	viper.SetDefault("RUN_MODE", RunModeAll)
+	viper.SetDefault("NATS_CONSUMER_WORKERS", 5)
+	viper.SetDefault("SERVE_API_FALLBACK_WRITES", false)
+	viper.SetDefault("MIGRATION_MODE", "check")
+	viper.SetDefault("CLICKS_PARTITION_INTERVAL", "month")
+	viper.SetDefault("CLICKS_PARTITION_PREMAKE", 3)
+	viper.SetDefault("CLICKS_RETENTION_DAYS", 0)
+	viper.SetDefault("CLICK_WRITER", "insert")
+	viper.SetDefault("BATCH_MIN_SIZE", 100)
+	viper.SetDefault("BATCH_MAX_SIZE", 1000)
+	viper.SetDefault("BATCH_MAX_BYTES", 1<<20)
+	viper.SetDefault("BATCH_MIN_LATENCY", "250ms")
+	viper.SetDefault("BATCH_MAX_LATENCY", "5s")
+	viper.SetDefault("BATCH_ADAPTIVE", true)
+	viper.SetDefault("BATCH_TARGET_INSERT_LATENCY", "500ms")
+	viper.SetDefault("BATCH_QUEUE_SIZE", 10000)
+	viper.SetDefault("BATCH_RETRY_BASE_DELAY", "500ms")
+	viper.SetDefault("BATCH_RETRY_MAX_DELAY", "30s")
+	viper.SetDefault("BREAKER_WINDOW", "60s")
+	viper.SetDefault("BREAKER_WINDOW_CALLS", 0)
+	viper.SetDefault("BREAKER_MIN_REQUESTS", 20)
+	viper.SetDefault("BREAKER_FAILURE_RATE", 0.5)
+	viper.SetDefault("BREAKER_SLOW_CALL_THRESHOLD", "5s")
+	viper.SetDefault("BREAKER_SLOW_CALL_RATE", 0.8)
+	viper.SetDefault("BREAKER_OPEN_TIMEOUT", "10s")
+	viper.SetDefault("BREAKER_HALF_OPEN_MAX_CALLS", 3)
+	viper.SetDefault("SPOOL_DIR", "spool")
+	viper.SetDefault("SPOOL_MAX_BYTES", 1<<30)
+	viper.SetDefault("ANALYTICS_CACHE_TTL", "24h")
+	viper.SetDefault("POSTGRES_MAX_OPEN_CONNS", 100)
+	viper.SetDefault("POSTGRES_MAX_IDLE_CONNS", 10)
+	viper.SetDefault("DB_WRITE_CONCURRENCY", 60)
+	viper.SetDefault("DB_READ_CONCURRENCY", 30)
+	viper.SetDefault("DB_QUEUE_TIMEOUT", "2s")
+	viper.SetDefault("HTTP_INGEST_CONCURRENCY", 1000)
+	viper.SetDefault("HTTP_ANALYTICS_CONCURRENCY", 16)
+	viper.SetDefault("HTTP_QUEUE_TIMEOUT", "500ms")
+	viper.SetDefault("HTTP_REQUEST_TIMEOUT", "10s")
+	viper.SetDefault("DB_QUERY_TIMEOUT", "3s")
+	viper.SetDefault("DB_BATCH_TIMEOUT", "30s")
+	viper.SetDefault("HEALTH_CHECK_TIMEOUT", "2s")
+	viper.SetDefault("HEALTH_CACHE_TTL", "2s")
+	viper.SetDefault("HEALTH_MAX_REPLICATION_LAG", "30s")
+	viper.SetDefault("HEALTH_MAX_BATCH_BACKLOG", 0.9)
+	viper.SetDefault("HEALTH_WRITER_STALL_TIMEOUT", "5m")
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "30s")
+	viper.SetDefault("SHUTDOWN_DRAIN_DELAY", "5s")
+	viper.SetDefault("METRICS_AD_LABEL_TOP_K", 50)
+	viper.SetDefault("METRICS_AD_LABEL_REFRESH", "1m")
+	viper.SetDefault("OTEL_EXPORTER", TraceExporterNone)
+	viper.SetDefault("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	viper.SetDefault("OTEL_SERVICE_NAME", "ads-metric-tracker")
+	viper.SetDefault("OTEL_TRACES_SAMPLE_RATIO", 1.0)
+	viper.SetDefault("RECONCILE_INTERVAL", "15m")
+	viper.SetDefault("RECONCILE_AUTO_FIX", false)
 
 	config := &Config{
+		AppEnv: viper.GetString("APP_ENV"),
+
 		HttpHost:         viper.GetString("HTTP_HOST"),
 		HttpPort:         viper.GetString("HTTP_PORT"),
+		AdminHost:        viper.GetString("ADMIN_HOST"),
+		AdminPort:        viper.GetString("ADMIN_PORT"),
 		LogFile:          viper.GetString("LOG_FILE"),
 		NATSURL:          viper.GetString("NATS_URL"),
 		PostgresHost:     viper.GetString("POSTGRES_HOST"),
@@ -51,6 +285,92 @@ func NewConfig() *Config {
 		RedisPort:        viper.GetString("REDIS_PORT"),
 		RedisPassword:    viper.GetString("REDIS_PASSWORD"),
 		RedisDB:          viper.GetInt("REDIS_DB"),
+
+		LogLevel:              viper.GetString("LOG_LEVEL"),
+		LogOutput:             viper.GetString("LOG_OUTPUT"),
+		LogEncoding:           viper.GetString("LOG_ENCODING"),
+		LogMaxSizeMB:          viper.GetInt("LOG_MAX_SIZE_MB"),
+		LogMaxBackups:         viper.GetInt("LOG_MAX_BACKUPS"),
+		LogMaxAgeDays:         viper.GetInt("LOG_MAX_AGE_DAYS"),
+		LogSamplingInitial:    viper.GetInt("LOG_SAMPLING_INITIAL"),
+		LogSamplingThereafter: viper.GetInt("LOG_SAMPLING_THEREAFTER"),
+
+		SeedMode:       viper.GetString("SEED_MODE"),
+		SeedRandomSeed: viper.GetInt64("SEED_RANDOM_SEED"),
+
+		RunMode:                viper.GetString("RUN_MODE"),
+		NATSConsumerWorkers:    viper.GetInt("NATS_CONSUMER_WORKERS"),
+		ServeAPIFallbackWrites: viper.GetBool("SERVE_API_FALLBACK_WRITES"),
+
+		MigrationMode: viper.GetString("MIGRATION_MODE"),
+
+		ClicksPartitionInterval: viper.GetString("CLICKS_PARTITION_INTERVAL"),
+		ClicksPartitionPremake:  viper.GetInt("CLICKS_PARTITION_PREMAKE"),
+		ClicksRetentionDays:     viper.GetInt("CLICKS_RETENTION_DAYS"),
+
+		ClickWriter: viper.GetString("CLICK_WRITER"),
+
+		BatchMinSize:             viper.GetInt("BATCH_MIN_SIZE"),
+		BatchMaxSize:             viper.GetInt("BATCH_MAX_SIZE"),
+		BatchMaxBytes:            viper.GetInt("BATCH_MAX_BYTES"),
+		BatchMinLatency:          viper.GetDuration("BATCH_MIN_LATENCY"),
+		BatchMaxLatency:          viper.GetDuration("BATCH_MAX_LATENCY"),
+		BatchAdaptive:            viper.GetBool("BATCH_ADAPTIVE"),
+		BatchTargetInsertLatency: viper.GetDuration("BATCH_TARGET_INSERT_LATENCY"),
+		BatchQueueSize:           viper.GetInt("BATCH_QUEUE_SIZE"),
+		BatchRetryBaseDelay:      viper.GetDuration("BATCH_RETRY_BASE_DELAY"),
+		BatchRetryMaxDelay:       viper.GetDuration("BATCH_RETRY_MAX_DELAY"),
+
+		BreakerWindow:            viper.GetDuration("BREAKER_WINDOW"),
+		BreakerWindowCalls:       viper.GetInt("BREAKER_WINDOW_CALLS"),
+		BreakerMinRequests:       viper.GetInt("BREAKER_MIN_REQUESTS"),
+		BreakerFailureRate:       viper.GetFloat64("BREAKER_FAILURE_RATE"),
+		BreakerSlowCallThreshold: viper.GetDuration("BREAKER_SLOW_CALL_THRESHOLD"),
+		BreakerSlowCallRate:      viper.GetFloat64("BREAKER_SLOW_CALL_RATE"),
+		BreakerOpenTimeout:       viper.GetDuration("BREAKER_OPEN_TIMEOUT"),
+		BreakerHalfOpenMaxCalls:  viper.GetInt("BREAKER_HALF_OPEN_MAX_CALLS"),
+
+		SpoolDir:          viper.GetString("SPOOL_DIR"),
+		SpoolMaxBytes:     viper.GetInt64("SPOOL_MAX_BYTES"),
+		AnalyticsCacheTTL: viper.GetDuration("ANALYTICS_CACHE_TTL"),
+
+		PostgresMaxOpenConns:     viper.GetInt("POSTGRES_MAX_OPEN_CONNS"),
+		PostgresMaxIdleConns:     viper.GetInt("POSTGRES_MAX_IDLE_CONNS"),
+		DBWriteConcurrency:       viper.GetInt("DB_WRITE_CONCURRENCY"),
+		DBReadConcurrency:        viper.GetInt("DB_READ_CONCURRENCY"),
+		DBQueueTimeout:           viper.GetDuration("DB_QUEUE_TIMEOUT"),
+		HTTPIngestConcurrency:    viper.GetInt("HTTP_INGEST_CONCURRENCY"),
+		HTTPAnalyticsConcurrency: viper.GetInt("HTTP_ANALYTICS_CONCURRENCY"),
+		HTTPQueueTimeout:         viper.GetDuration("HTTP_QUEUE_TIMEOUT"),
+
+		HTTPRequestTimeout: viper.GetDuration("HTTP_REQUEST_TIMEOUT"),
+		DBQueryTimeout:     viper.GetDuration("DB_QUERY_TIMEOUT"),
+		DBBatchTimeout:     viper.GetDuration("DB_BATCH_TIMEOUT"),
+
+		HealthCheckTimeout:       viper.GetDuration("HEALTH_CHECK_TIMEOUT"),
+		HealthCacheTTL:           viper.GetDuration("HEALTH_CACHE_TTL"),
+		HealthMaxReplicationLag:  viper.GetDuration("HEALTH_MAX_REPLICATION_LAG"),
+		HealthMaxBatchBacklog:    viper.GetFloat64("HEALTH_MAX_BATCH_BACKLOG"),
+		HealthWriterStallTimeout: viper.GetDuration("HEALTH_WRITER_STALL_TIMEOUT"),
+
+		ShutdownTimeout:    viper.GetDuration("SHUTDOWN_TIMEOUT"),
+		ShutdownDrainDelay: viper.GetDuration("SHUTDOWN_DRAIN_DELAY"),
+
+		MetricsAdLabelTopK:      viper.GetInt("METRICS_AD_LABEL_TOP_K"),
+		MetricsAdLabelAllowlist: splitList(viper.GetString("METRICS_AD_LABEL_ALLOWLIST")),
+		MetricsAdLabelRefresh:   viper.GetDuration("METRICS_AD_LABEL_REFRESH"),
+
+		OTELExporter:    viper.GetString("OTEL_EXPORTER"),
+		OTELEndpoint:    viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTELServiceName: viper.GetString("OTEL_SERVICE_NAME"),
+		OTELSampleRatio: viper.GetFloat64("OTEL_TRACES_SAMPLE_RATIO"),
+
+		ReconcileInterval: viper.GetDuration("RECONCILE_INTERVAL"),
+		ReconcileAutoFix:  viper.GetBool("RECONCILE_AUTO_FIX"),
+	}
+
+	if config.SeedMode == "" {
+		config.SeedMode = defaultSeedModes[config.AppEnv]
 	}
 
 	config.Validate()
@@ -66,7 +386,10 @@ func (c *Config) Validate() {
 	if c.HttpPort == "" {
 		missing = append(missing, "HTTP_PORT")
 	}
-	if c.LogFile == "" {
+	if c.AdminPort == "" {
+		missing = append(missing, "ADMIN_PORT")
+	}
+	if c.LogFile == "" && c.LogOutput != LogOutputStdout {
 		missing = append(missing, "LOG_FILE")
 	}
 	if c.NATSURL == "" {
@@ -94,11 +417,135 @@ func (c *Config) Validate() {
 		missing = append(missing, "REDIS_PORT")
 	}
 
-	if len(missing) > 0 {
-		log.Println("Missing required configuration values:")
-		for _, key := range missing {
-			fmt.Println(" -", key)
+	var invalid []string
+
+	if c.AdminPort == c.HttpPort {
+		invalid = append(invalid, "ADMIN_PORT (not HTTP_PORT)")
+	}
+	if _, ok := defaultSeedModes[c.AppEnv]; !ok {
+		invalid = append(invalid, "APP_ENV (dev|test|prod)")
+	}
+	switch c.SeedMode {
+	case SeedModeOff, SeedModeSample, SeedModeTest:
+	default:
+		invalid = append(invalid, "SEED_MODE (off|sample|test)")
+	}
+	if c.AppEnv == EnvProd && c.SeedMode != SeedModeOff {
+		invalid = append(invalid, "SEED_MODE (off when APP_ENV=prod)")
+	}
+	if !ValidRunMode(c.RunMode) {
+		invalid = append(invalid, "RUN_MODE (all|serve-api|consume)")
+	}
+	if c.NATSConsumerWorkers <= 0 {
+		invalid = append(invalid, "NATS_CONSUMER_WORKERS (> 0)")
+	}
+	switch c.MigrationMode {
+	case "auto", "check", "off":
+	default:
+		invalid = append(invalid, "MIGRATION_MODE (auto|check|off)")
+	}
+	if c.ClickWriter != "insert" && c.ClickWriter != "copy" {
+		invalid = append(invalid, "CLICK_WRITER (insert|copy)")
+	}
+	if c.BatchMaxSize <= 0 {
+		invalid = append(invalid, "BATCH_MAX_SIZE (> 0)")
+	}
+	if c.BatchQueueSize <= 0 {
+		invalid = append(invalid, "BATCH_QUEUE_SIZE (> 0)")
+	}
+	if c.BatchMaxLatency <= 0 {
+		invalid = append(invalid, "BATCH_MAX_LATENCY (> 0)")
+	}
+	if c.BreakerFailureRate <= 0 || c.BreakerFailureRate > 1 {
+		invalid = append(invalid, "BREAKER_FAILURE_RATE (0 < rate <= 1)")
+	}
+	if c.BreakerWindowCalls != 0 && c.BreakerWindowCalls < c.BreakerMinRequests {
+		invalid = append(invalid, "BREAKER_WINDOW_CALLS (0 or >= BREAKER_MIN_REQUESTS)")
+	}
+	if c.BreakerSlowCallRate < 0 || c.BreakerSlowCallRate > 1 {
+		invalid = append(invalid, "BREAKER_SLOW_CALL_RATE (0 <= rate <= 1)")
+	}
+	if c.PostgresMaxOpenConns <= 0 {
+		invalid = append(invalid, "POSTGRES_MAX_OPEN_CONNS (> 0)")
+	}
+	if c.DBWriteConcurrency <= 0 || c.DBReadConcurrency <= 0 {
+		invalid = append(invalid, "DB_WRITE_CONCURRENCY, DB_READ_CONCURRENCY (> 0)")
+	}
+	// Reads and writes must fit in the pool together, or one could still starve the other
+	if c.DBWriteConcurrency+c.DBReadConcurrency > c.PostgresMaxOpenConns {
+		invalid = append(invalid, "DB_WRITE_CONCURRENCY + DB_READ_CONCURRENCY (<= POSTGRES_MAX_OPEN_CONNS)")
+	}
+	if c.HTTPIngestConcurrency <= 0 || c.HTTPAnalyticsConcurrency <= 0 {
+		invalid = append(invalid, "HTTP_INGEST_CONCURRENCY, HTTP_ANALYTICS_CONCURRENCY (> 0)")
+	}
+	if c.HealthMaxBatchBacklog <= 0 || c.HealthMaxBatchBacklog > 1 {
+		invalid = append(invalid, "HEALTH_MAX_BATCH_BACKLOG (0 < ratio <= 1)")
+	}
+	if c.ClicksPartitionInterval != "day" && c.ClicksPartitionInterval != "month" {
+		invalid = append(invalid, "CLICKS_PARTITION_INTERVAL (day|month)")
+	}
+	// Dropped partitions would look like drift and get "fixed" downwards
+	if c.ReconcileAutoFix && c.ClicksRetentionDays > 0 {
+		invalid = append(invalid, "RECONCILE_AUTO_FIX (false when CLICKS_RETENTION_DAYS > 0)")
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid = append(invalid, "LOG_LEVEL (debug|info|warn|error)")
+	}
+	switch c.LogOutput {
+	case LogOutputStdout, LogOutputFile, LogOutputBoth:
+	default:
+		invalid = append(invalid, "LOG_OUTPUT (stdout|file|both)")
+	}
+	if c.LogEncoding != LogEncodingJSON && c.LogEncoding != LogEncodingConsole {
+		invalid = append(invalid, "LOG_ENCODING (json|console)")
+	}
+	if c.LogMaxSizeMB <= 0 {
+		invalid = append(invalid, "LOG_MAX_SIZE_MB (> 0)")
+	}
+	if c.LogSamplingInitial < 0 || c.LogSamplingThereafter < 0 {
+		invalid = append(invalid, "LOG_SAMPLING_INITIAL, LOG_SAMPLING_THEREAFTER (>= 0)")
+	}
+	if c.MetricsAdLabelTopK < 0 {
+		invalid = append(invalid, "METRICS_AD_LABEL_TOP_K (>= 0)")
+	}
+	if c.MetricsAdLabelRefresh <= 0 {
+		invalid = append(invalid, "METRICS_AD_LABEL_REFRESH (> 0)")
+	}
+	switch c.OTELExporter {
+	case TraceExporterNone, TraceExporterOTLP, TraceExporterStdout:
+	default:
+		invalid = append(invalid, "OTEL_EXPORTER (none|otlp|stdout)")
+	}
+	if c.OTELSampleRatio < 0 || c.OTELSampleRatio > 1 {
+		invalid = append(invalid, "OTEL_TRACES_SAMPLE_RATIO (0 <= ratio <= 1)")
+	}
+
+	if len(missing) > 0 || len(invalid) > 0 {
+		if len(missing) > 0 {
+			log.Println("Missing required configuration values:")
+			for _, key := range missing {
+				fmt.Println(" -", key)
+			}
+		}
+		if len(invalid) > 0 {
+			log.Println("Invalid configuration values:")
+			for _, key := range invalid {
+				fmt.Println(" -", key)
+			}
 		}
 		panic("configuration validation failed")
 	}
 }
+
+// splitList splits a comma-separated setting, dropping blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
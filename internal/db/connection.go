@@ -8,7 +8,6 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/ratheeshkumar25/adsmetrictracker/config"
-	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -17,6 +16,7 @@ import (
 type Database struct {
 	PostgresDB *gorm.DB
 	RedisDB    *redis.Client
+	Partitions *PartitionManager
 }
 
 type DatabaseConfig struct {
@@ -40,7 +40,7 @@ type RedisConfig struct {
 
 func NewDatabase(cfg *config.Config) (*Database, error) {
 	// PostgreSQL connection
-	db, err := initPostgreSQL(cfg)
+	db, err := ConnectPostgreSQL(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize PostgreSQL: %w", err)
 	}
@@ -51,18 +51,23 @@ func NewDatabase(cfg *config.Config) (*Database, error) {
 		return nil, fmt.Errorf("failed to initialize Redis: %w", err)
 	}
 
-	// Auto-migrate models
-	if err := runMigrations(db); err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	partitions := NewPartitionManager(db, cfg)
+
+	// Apply or verify versioned schema migrations
+	if err := prepareSchema(db, cfg.MigrationMode, partitions); err != nil {
+		return nil, fmt.Errorf("failed to prepare database schema: %w", err)
 	}
 
 	return &Database{
 		PostgresDB: db,
 		RedisDB:    rdb,
+		Partitions: partitions,
 	}, nil
 }
 
-func initPostgreSQL(cfg *config.Config) (*gorm.DB, error) {
+// ConnectPostgreSQL opens a pooled PostgreSQL connection without touching the
+// schema; used directly by tooling such as the migrate command.
+func ConnectPostgreSQL(cfg *config.Config) (*gorm.DB, error) {
 	dbConfig := DatabaseConfig{
 		Host:         cfg.PostgresHost,
 		Port:         cfg.PostgresPort,
@@ -70,8 +75,8 @@ func initPostgreSQL(cfg *config.Config) (*gorm.DB, error) {
 		Password:     cfg.PostgresPassword,
 		DBName:       cfg.PostgresDBName,
 		SSLMode:      "disable",
-		MaxIdleConns: 10,
-		MaxOpenConns: 100,
+		MaxIdleConns: cfg.PostgresMaxIdleConns,
+		MaxOpenConns: cfg.PostgresMaxOpenConns,
 		MaxLifetime:  time.Hour,
 	}
 
@@ -105,6 +110,11 @@ func initPostgreSQL(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
 
+	// Trace every statement as a child of the caller's span
+	if err := db.Use(gormTracing{}); err != nil {
+		return nil, fmt.Errorf("failed to register GORM tracing: %w", err)
+	}
+
 	// Configure connection pool
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -147,6 +157,7 @@ func initRedis(cfg *config.Config) (*redis.Client, error) {
 		PoolSize:     10,
 		MinIdleConns: 5,
 	})
+	rdb.AddHook(redisTracingHook{})
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -161,95 +172,136 @@ func initRedis(cfg *config.Config) (*redis.Client, error) {
 	return rdb, nil
 }
 
-func runMigrations(db *gorm.DB) error {
-	log.Println("Running database migrations...")
+// prepareSchema applies or verifies migrations according to MIGRATION_MODE
+// and then brings clicks partitions up to date.
+func prepareSchema(db *gorm.DB, mode string, partitions *PartitionManager) error {
+	if mode == MigrationModeOff {
+		log.Println("Schema migrations disabled (MIGRATION_MODE=off)")
+		return nil
+	}
 
-	if err := db.AutoMigrate(&model.Ad{}, &model.Clicks{}); err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case MigrationModeAuto:
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		log.Printf("Database migrations completed successfully (%d applied)", len(applied))
+	case MigrationModeCheck:
+		pending, err := migrator.Pending()
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("database schema is behind: %d pending migration(s), first is %04d_%s; run `adsmetrics migrate up`",
+				len(pending), pending[0].Version, pending[0].Name)
+		}
+	default:
+		return fmt.Errorf("unknown migration mode %q", mode)
 	}
 
-	// Create indexes for better performance
-	if err := createIndexes(db); err != nil {
-		return fmt.Errorf("failed to create indexes: %w", err)
+	if err := partitions.Maintain(); err != nil {
+		return fmt.Errorf("failed to maintain clicks partitions: %w", err)
 	}
 
-	log.Println("Database migrations completed successfully")
 	return nil
 }
 
-func createIndexes(db *gorm.DB) error {
-	// Index on clicks.ad_id for faster analytics queries
-	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_clicks_ad_id ON clicks(ad_id)").Error; err != nil {
+func (d *Database) Close() error {
+	if err := d.ClosePostgres(); err != nil {
 		return err
 	}
-
-	// Index on clicks.timestamp for time-based queries
-	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_clicks_timestamp ON clicks(timestamp)").Error; err != nil {
+	if err := d.CloseRedis(); err != nil {
 		return err
 	}
 
-	// Composite index on ad_id and timestamp for analytics
-	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_clicks_ad_timestamp ON clicks(ad_id, timestamp)").Error; err != nil {
-		return err
-	}
+	log.Println("Database connections closed successfully")
+	return nil
+}
 
-	// Index on clicks.ip for duplicate detection
-	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_clicks_ip ON clicks(ip)").Error; err != nil {
-		return err
+// ClosePostgres closes the PostgreSQL connection pool
+func (d *Database) ClosePostgres() error {
+	if d.PostgresDB == nil {
+		return nil
 	}
 
-	log.Println("Database indexes created successfully")
+	sqlDB, err := d.PostgresDB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		return fmt.Errorf("failed to close PostgreSQL connection: %w", err)
+	}
 	return nil
 }
 
-func (d *Database) Close() error {
-	// Close PostgreSQL connection
-	if d.PostgresDB != nil {
-		sqlDB, err := d.PostgresDB.DB()
-		if err != nil {
-			return fmt.Errorf("failed to get underlying sql.DB: %w", err)
-		}
-		if err := sqlDB.Close(); err != nil {
-			return fmt.Errorf("failed to close PostgreSQL connection: %w", err)
-		}
+// CloseRedis closes the Redis client
+func (d *Database) CloseRedis() error {
+	if d.RedisDB == nil {
+		return nil
 	}
 
-	// Close Redis connection
-	if d.RedisDB != nil {
-		if err := d.RedisDB.Close(); err != nil {
-			return fmt.Errorf("failed to close Redis connection: %w", err)
-		}
+	if err := d.RedisDB.Close(); err != nil {
+		return fmt.Errorf("failed to close Redis connection: %w", err)
 	}
-
-	log.Println("Database connections closed successfully")
 	return nil
 }
 
+// Health pings PostgreSQL and Redis
 func (d *Database) Health() error {
-	// Check PostgreSQL health
-	if d.PostgresDB != nil {
-		sqlDB, err := d.PostgresDB.DB()
-		if err != nil {
-			return fmt.Errorf("PostgreSQL health check failed: %w", err)
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
+	if err := d.PingPostgres(ctx); err != nil {
+		return err
+	}
+	return d.PingRedis(ctx)
+}
 
-		if err := sqlDB.PingContext(ctx); err != nil {
-			return fmt.Errorf("PostgreSQL ping failed: %w", err)
-		}
+// PingPostgres checks PostgreSQL answers within ctx
+func (d *Database) PingPostgres(ctx context.Context) error {
+	if d.PostgresDB == nil {
+		return nil
 	}
 
-	// Check Redis health
-	if d.RedisDB != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
+	sqlDB, err := d.PostgresDB.DB()
+	if err != nil {
+		return fmt.Errorf("PostgreSQL health check failed: %w", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("PostgreSQL ping failed: %w", err)
+	}
+	return nil
+}
 
-		if _, err := d.RedisDB.Ping(ctx).Result(); err != nil {
-			return fmt.Errorf("Redis ping failed: %w", err)
-		}
+// PingRedis checks Redis answers within ctx
+func (d *Database) PingRedis(ctx context.Context) error {
+	if d.RedisDB == nil {
+		return nil
 	}
 
+	if _, err := d.RedisDB.Ping(ctx).Result(); err != nil {
+		return fmt.Errorf("Redis ping failed: %w", err)
+	}
 	return nil
 }
+
+// ReplicationLag returns how far WAL replay is behind: on a standby, the age
+// of the last replayed transaction; on a primary, the largest replay lag of
+// its streaming replicas. Zero when there is no replication.
+func (d *Database) ReplicationLag(ctx context.Context) (time.Duration, error) {
+	var seconds float64
+	err := d.PostgresDB.WithContext(ctx).Raw(`SELECT CASE WHEN pg_is_in_recovery()
+			THEN COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+			ELSE COALESCE((SELECT EXTRACT(EPOCH FROM MAX(replay_lag)) FROM pg_stat_replication), 0)
+		END`).Scan(&seconds).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to read replication lag: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,31 @@
+-- Baseline schema as previously produced by GORM AutoMigrate. Every statement
+-- is idempotent so databases created before versioned migrations are adopted
+-- without changes.
+
+CREATE TABLE IF NOT EXISTS ads (
+    id           char(36)      NOT NULL,
+    image_url    varchar(2048) NOT NULL,
+    target_url   varchar(2048) NOT NULL,
+    created_at   timestamptz,
+    updated_at   timestamptz,
+    deleted_at   timestamptz,
+    total_clicks bigint        NOT NULL DEFAULT 0,
+    CONSTRAINT ads_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ads_deleted_at ON ads (deleted_at);
+
+CREATE TABLE IF NOT EXISTS clicks (
+    id            char(36)    NOT NULL,
+    ad_id         char(36)    NOT NULL,
+    ip            varchar(45) NOT NULL,
+    playback_time bigint      NOT NULL,
+    timestamp     timestamptz NOT NULL,
+    CONSTRAINT clicks_pkey PRIMARY KEY (id),
+    CONSTRAINT fk_ads_clicks FOREIGN KEY (ad_id) REFERENCES ads (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_clicks_ad_id ON clicks (ad_id);
+CREATE INDEX IF NOT EXISTS idx_clicks_timestamp ON clicks (timestamp);
+CREATE INDEX IF NOT EXISTS idx_clicks_ad_timestamp ON clicks (ad_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_clicks_ip ON clicks (ip);
@@ -0,0 +1,41 @@
+-- Fold the partitioned clicks table back into a single heap. Rows sharing an
+-- id across partitions keep only the first copy.
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE c.relname = 'clicks' AND c.relkind = 'p' AND n.nspname = current_schema()
+    ) THEN
+        LOCK TABLE clicks IN ACCESS EXCLUSIVE MODE;
+        ALTER TABLE clicks RENAME TO clicks_partitioned;
+        ALTER TABLE clicks_partitioned RENAME CONSTRAINT clicks_pkey TO clicks_partitioned_pkey;
+        DROP INDEX IF EXISTS idx_clicks_ad_id;
+        DROP INDEX IF EXISTS idx_clicks_timestamp;
+        DROP INDEX IF EXISTS idx_clicks_ad_timestamp;
+        DROP INDEX IF EXISTS idx_clicks_ip;
+
+        CREATE TABLE clicks (
+            id            char(36)    NOT NULL,
+            ad_id         char(36)    NOT NULL,
+            ip            varchar(45) NOT NULL,
+            playback_time bigint      NOT NULL,
+            timestamp     timestamptz NOT NULL,
+            CONSTRAINT clicks_pkey PRIMARY KEY (id),
+            CONSTRAINT fk_ads_clicks FOREIGN KEY (ad_id) REFERENCES ads (id)
+        );
+
+        INSERT INTO clicks (id, ad_id, ip, playback_time, timestamp)
+        SELECT id, ad_id, ip, playback_time, timestamp FROM clicks_partitioned
+        ON CONFLICT (id) DO NOTHING;
+
+        DROP TABLE clicks_partitioned;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_clicks_ad_id ON clicks (ad_id);
+CREATE INDEX IF NOT EXISTS idx_clicks_timestamp ON clicks (timestamp);
+CREATE INDEX IF NOT EXISTS idx_clicks_ad_timestamp ON clicks (ad_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_clicks_ip ON clicks (ip);
@@ -0,0 +1,70 @@
+-- Convert clicks into a table range-partitioned by timestamp. Existing rows
+-- are copied into monthly partitions; the partition manager creates future
+-- partitions and enforces retention at runtime. The copy holds an ACCESS
+-- EXCLUSIVE lock on clicks for its duration.
+
+DO $$
+DECLARE
+    legacy boolean;
+    oldest timestamp;
+    bucket timestamp;
+BEGIN
+    SELECT EXISTS (
+        SELECT 1
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE c.relname = 'clicks' AND c.relkind = 'r' AND n.nspname = current_schema()
+    ) INTO legacy;
+
+    IF legacy THEN
+        LOCK TABLE clicks IN ACCESS EXCLUSIVE MODE;
+        ALTER TABLE clicks RENAME TO clicks_unpartitioned;
+        ALTER TABLE clicks_unpartitioned RENAME CONSTRAINT clicks_pkey TO clicks_unpartitioned_pkey;
+        DROP INDEX IF EXISTS idx_clicks_ad_id;
+        DROP INDEX IF EXISTS idx_clicks_timestamp;
+        DROP INDEX IF EXISTS idx_clicks_ad_timestamp;
+        DROP INDEX IF EXISTS idx_clicks_ip;
+    END IF;
+
+    -- The partition key has to be part of the primary key
+    CREATE TABLE IF NOT EXISTS clicks (
+        id            char(36)    NOT NULL,
+        ad_id         char(36)    NOT NULL,
+        ip            varchar(45) NOT NULL,
+        playback_time bigint      NOT NULL,
+        timestamp     timestamptz NOT NULL,
+        CONSTRAINT clicks_pkey PRIMARY KEY (id, timestamp),
+        CONSTRAINT fk_clicks_ad FOREIGN KEY (ad_id) REFERENCES ads (id)
+    ) PARTITION BY RANGE (timestamp);
+
+    -- Catch-all for rows outside any pre-created range so inserts never fail
+    CREATE TABLE IF NOT EXISTS clicks_default PARTITION OF clicks DEFAULT;
+
+    IF legacy THEN
+        SELECT date_trunc('month', MIN(timestamp) AT TIME ZONE 'UTC') INTO oldest FROM clicks_unpartitioned;
+
+        IF oldest IS NOT NULL THEN
+            FOR bucket IN
+                SELECT generate_series(oldest, date_trunc('month', now() AT TIME ZONE 'UTC'), interval '1 month')
+            LOOP
+                EXECUTE format(
+                    'CREATE TABLE IF NOT EXISTS %I PARTITION OF clicks FOR VALUES FROM (%L) TO (%L)',
+                    'clicks_p' || to_char(bucket, 'YYYYMM'),
+                    bucket AT TIME ZONE 'UTC',
+                    (bucket + interval '1 month') AT TIME ZONE 'UTC'
+                );
+            END LOOP;
+        END IF;
+
+        INSERT INTO clicks (id, ad_id, ip, playback_time, timestamp)
+        SELECT id, ad_id, ip, playback_time, timestamp FROM clicks_unpartitioned;
+
+        DROP TABLE clicks_unpartitioned;
+    END IF;
+END $$;
+
+-- Indexes on the partitioned parent cascade to every partition
+CREATE INDEX IF NOT EXISTS idx_clicks_ad_id ON clicks (ad_id);
+CREATE INDEX IF NOT EXISTS idx_clicks_timestamp ON clicks (timestamp);
+CREATE INDEX IF NOT EXISTS idx_clicks_ad_timestamp ON clicks (ad_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_clicks_ip ON clicks (ip);
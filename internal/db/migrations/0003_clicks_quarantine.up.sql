@@ -0,0 +1,16 @@
+-- Clicks the batch writer could not persist because of a permanent error
+-- (e.g. the ad was deleted). They are kept for inspection and replay instead
+-- of blocking the batches they arrived in.
+
+CREATE TABLE IF NOT EXISTS clicks_quarantine (
+    id             char(36)    NOT NULL,
+    ad_id          char(36)    NOT NULL,
+    ip             varchar(45) NOT NULL,
+    playback_time  bigint      NOT NULL,
+    timestamp      timestamptz NOT NULL,
+    error          text        NOT NULL,
+    quarantined_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT clicks_quarantine_pkey PRIMARY KEY (id, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS idx_clicks_quarantine_quarantined_at ON clicks_quarantine (quarantined_at);
@@ -0,0 +1,15 @@
+-- API keys issued through `adsmetrics apikey`. Only a SHA-256 hash of each key
+-- is stored; the prefix identifies a key in listings and revocations.
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id         char(36)    NOT NULL,
+    name       varchar(255) NOT NULL,
+    prefix     varchar(16) NOT NULL,
+    key_hash   char(64)    NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    revoked_at timestamptz,
+    CONSTRAINT api_keys_pkey PRIMARY KEY (id),
+    CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
@@ -0,0 +1,4 @@
+ALTER TABLE clicks_quarantine DROP CONSTRAINT IF EXISTS clicks_quarantine_pkey;
+ALTER TABLE clicks_quarantine ADD CONSTRAINT clicks_quarantine_pkey PRIMARY KEY (id, timestamp);
+
+DROP TABLE IF EXISTS click_ids;
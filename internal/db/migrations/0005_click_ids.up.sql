@@ -0,0 +1,26 @@
+-- Dedupe clicks on their ID alone. The partitioned clicks table can only
+-- enforce (id, timestamp), so a redelivered click carrying a different
+-- timestamp would be stored and counted twice. click_ids is not partitioned
+-- and is written in the same transaction as clicks; timestamp is kept so
+-- retention can prune it along with the dropped partitions.
+
+CREATE TABLE IF NOT EXISTS click_ids (
+    id        char(36)    NOT NULL,
+    timestamp timestamptz NOT NULL,
+    CONSTRAINT click_ids_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_ids_timestamp ON click_ids (timestamp);
+
+INSERT INTO click_ids (id, timestamp)
+SELECT id, MIN(timestamp) FROM clicks GROUP BY id
+ON CONFLICT (id) DO NOTHING;
+
+-- The quarantine dedupes on the ID as well, keeping the first copy
+DELETE FROM clicks_quarantine q
+USING clicks_quarantine newer
+WHERE q.id = newer.id
+  AND (q.quarantined_at, q.timestamp) > (newer.quarantined_at, newer.timestamp);
+
+ALTER TABLE clicks_quarantine DROP CONSTRAINT IF EXISTS clicks_quarantine_pkey;
+ALTER TABLE clicks_quarantine ADD CONSTRAINT clicks_quarantine_pkey PRIMARY KEY (id);
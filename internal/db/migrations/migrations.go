@@ -0,0 +1,9 @@
+// Package migrations holds the versioned SQL schema migrations. Files are
+// named NNNN_description.up.sql / NNNN_description.down.sql and are applied
+// in version order by db.Migrator.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,289 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"gorm.io/gorm"
+)
+
+// partitionLockKey is the pg_advisory_xact_lock key that keeps replicas from
+// maintaining partitions at the same time
+const partitionLockKey int64 = 0x61647370617274 // "adspart"
+
+const (
+	clicksTable           = "clicks"
+	clicksDefaultPartName = "clicks_default"
+	clicksPartitionPrefix = "clicks_p"
+)
+
+// PartitionInterval is the width of a single clicks partition
+type PartitionInterval string
+
+const (
+	PartitionDaily   PartitionInterval = "day"
+	PartitionMonthly PartitionInterval = "month"
+)
+
+// PartitionManager keeps the range-partitioned clicks table healthy: it
+// pre-creates partitions ahead of time and drops the ones past retention.
+// The partitioned parent itself is created by migration 0002.
+type PartitionManager struct {
+	db        *gorm.DB
+	interval  PartitionInterval
+	premake   int
+	retention time.Duration
+}
+
+// NewPartitionManager creates a partition manager from configuration
+func NewPartitionManager(db *gorm.DB, cfg *config.Config) *PartitionManager {
+	return &PartitionManager{
+		db:        db,
+		interval:  PartitionInterval(cfg.ClicksPartitionInterval),
+		premake:   cfg.ClicksPartitionPremake,
+		retention: time.Duration(cfg.ClicksRetentionDays) * 24 * time.Hour,
+	}
+}
+
+// Maintain pre-creates upcoming partitions and drops expired ones, in one
+// transaction holding an advisory lock. Every replica runs it at startup and
+// on a ticker; if another one is already at it this run is skipped, since
+// that replica does the same work.
+func (m *PartitionManager) Maintain() error {
+	now := time.Now().UTC()
+
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", partitionLockKey).Scan(&locked).Error; err != nil {
+			return fmt.Errorf("failed to acquire partition lock: %w", err)
+		}
+		if !locked {
+			log.Println("Partition maintenance is running elsewhere, skipping")
+			return nil
+		}
+
+		if err := m.createPartitions(tx, now, now); err != nil {
+			return fmt.Errorf("failed to create partitions: %w", err)
+		}
+
+		if err := m.dropExpired(tx, now); err != nil {
+			return fmt.Errorf("failed to drop expired partitions: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// StartMaintenance runs Maintain periodically in the background until ctx is done
+func (m *PartitionManager) StartMaintenance(ctx context.Context, every time.Duration) {
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.Maintain(); err != nil {
+					log.Printf("Partition maintenance failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// createPartitions makes sure partitions exist from the one containing from
+// up to premake intervals past the one containing now.
+func (m *PartitionManager) createPartitions(tx *gorm.DB, from, now time.Time) error {
+	existing, err := m.listPartitions(tx)
+	if err != nil {
+		return err
+	}
+
+	last := m.advance(m.truncate(now), m.premake)
+	for start := m.truncate(from); !start.After(last); start = m.advance(start, 1) {
+		end := m.advance(start, 1)
+		if overlapsAny(existing, start, end) {
+			continue
+		}
+
+		name := m.partitionName(start)
+		if err := createPartition(tx, name, start, end); err != nil {
+			return fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+
+		existing = append(existing, partitionRange{name: name, start: start, end: end})
+		log.Printf("Created clicks partition %s", name)
+	}
+
+	return nil
+}
+
+// createPartition attaches a new range partition. Rows that already landed in
+// the default partition for that range (e.g. clicks with far-future client
+// timestamps) would block the CREATE, so they are moved across first. The
+// default partition is locked against inserts for the rest of the
+// transaction, so no row can land there between the count and the CREATE.
+func createPartition(tx *gorm.DB, name string, start, end time.Time) error {
+	from, to := start.Format(time.RFC3339), end.Format(time.RFC3339)
+
+	if err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE MODE", clicksDefaultPartName)).Error; err != nil {
+		return err
+	}
+
+	var stray int64
+	err := tx.Raw(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE timestamp >= ? AND timestamp < ?", clicksDefaultPartName), start, end).
+		Scan(&stray).Error
+	if err != nil {
+		return err
+	}
+
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF clicks FOR VALUES FROM ('%s') TO ('%s')", name, from, to)
+	if stray == 0 {
+		return tx.Exec(create).Error
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		stmts := []string{
+			fmt.Sprintf("ALTER TABLE clicks DETACH PARTITION %s", clicksDefaultPartName),
+			create,
+			fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'", name, clicksDefaultPartName, from, to),
+			fmt.Sprintf("DELETE FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'", clicksDefaultPartName, from, to),
+			fmt.Sprintf("ALTER TABLE clicks ATTACH PARTITION %s DEFAULT", clicksDefaultPartName),
+		}
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("Moved %d clicks from %s into %s", stray, clicksDefaultPartName, name)
+		return nil
+	})
+}
+
+// dropExpired drops partitions whose upper bound is older than the retention
+// window and trims expired rows from the default partition and click_ids.
+func (m *PartitionManager) dropExpired(tx *gorm.DB, now time.Time) error {
+	if m.retention <= 0 {
+		return nil
+	}
+
+	cutoff := now.Add(-m.retention)
+
+	partitions, err := m.listPartitions(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range partitions {
+		if p.end.After(cutoff) {
+			continue
+		}
+		if err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", p.name)).Error; err != nil {
+			return fmt.Errorf("failed to drop partition %s: %w", p.name, err)
+		}
+		log.Printf("Dropped expired clicks partition %s", p.name)
+	}
+
+	if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE timestamp < ?", clicksDefaultPartName), cutoff).Error; err != nil {
+		return fmt.Errorf("failed to trim default partition: %w", err)
+	}
+
+	if err := tx.Exec("DELETE FROM click_ids WHERE timestamp < ?", cutoff).Error; err != nil {
+		return fmt.Errorf("failed to trim click_ids: %w", err)
+	}
+
+	return nil
+}
+
+type partitionRange struct {
+	name  string
+	start time.Time
+	end   time.Time
+}
+
+// listPartitions returns the ranged partitions currently attached to clicks
+func (m *PartitionManager) listPartitions(tx *gorm.DB) ([]partitionRange, error) {
+	var names []string
+	err := tx.Raw(`SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		JOIN pg_namespace ns ON ns.oid = parent.relnamespace
+		WHERE parent.relname = ? AND ns.nspname = current_schema()`, clicksTable).
+		Scan(&names).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clicks partitions: %w", err)
+	}
+
+	partitions := make([]partitionRange, 0, len(names))
+	for _, name := range names {
+		if p, ok := parsePartitionName(name); ok {
+			partitions = append(partitions, p)
+		}
+	}
+	return partitions, nil
+}
+
+func (m *PartitionManager) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	if m.interval == PartitionDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (m *PartitionManager) advance(t time.Time, n int) time.Time {
+	if m.interval == PartitionDaily {
+		return t.AddDate(0, 0, n)
+	}
+	return t.AddDate(0, n, 0)
+}
+
+func (m *PartitionManager) partitionName(start time.Time) string {
+	if m.interval == PartitionDaily {
+		return clicksPartitionPrefix + start.Format("20060102")
+	}
+	return clicksPartitionPrefix + start.Format("200601")
+}
+
+// parsePartitionName recovers the range of a partition from its name. Both
+// daily (clicks_pYYYYMMDD) and monthly (clicks_pYYYYMM) names are understood
+// so that changing the interval does not orphan older partitions.
+func parsePartitionName(name string) (partitionRange, bool) {
+	suffix, ok := strings.CutPrefix(name, clicksPartitionPrefix)
+	if !ok {
+		return partitionRange{}, false
+	}
+
+	switch len(suffix) {
+	case 8:
+		start, err := time.ParseInLocation("20060102", suffix, time.UTC)
+		if err != nil {
+			return partitionRange{}, false
+		}
+		return partitionRange{name: name, start: start, end: start.AddDate(0, 0, 1)}, true
+	case 6:
+		start, err := time.ParseInLocation("200601", suffix, time.UTC)
+		if err != nil {
+			return partitionRange{}, false
+		}
+		return partitionRange{name: name, start: start, end: start.AddDate(0, 1, 0)}, true
+	default:
+		return partitionRange{}, false
+	}
+}
+
+func overlapsAny(partitions []partitionRange, start, end time.Time) bool {
+	for _, p := range partitions {
+		if start.Before(p.end) && p.start.Before(end) {
+			return true
+		}
+	}
+	return false
+}
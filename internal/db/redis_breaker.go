@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+)
+
+// GuardRedis routes every Redis command and pipeline through cb
+func (d *Database) GuardRedis(cb *breaker.CircuitBreaker) {
+	if d.RedisDB != nil {
+		d.RedisDB.AddHook(redisBreakerHook{cb: cb})
+	}
+}
+
+// IsRedisFailure reports whether a Redis error should count against its
+// breaker; a missing key is a normal result, not a failure
+func IsRedisFailure(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil) && !errors.Is(err, context.Canceled)
+}
+
+type redisBreakerDoneKey struct{}
+
+// redisBreakerHook admits commands through a circuit breaker. go-redis calls
+// AfterProcess even for a command BeforeProcess rejected, so the outcome is
+// only reported when the context carries the admission's done func.
+type redisBreakerHook struct {
+	cb *breaker.CircuitBreaker
+}
+
+func (h redisBreakerHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return h.admit(ctx)
+}
+
+func (h redisBreakerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.report(ctx, cmd.Err())
+	return nil
+}
+
+func (h redisBreakerHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return h.admit(ctx)
+}
+
+func (h redisBreakerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); IsRedisFailure(cmdErr) {
+			err = cmdErr
+			break
+		}
+	}
+	h.report(ctx, err)
+	return nil
+}
+
+func (h redisBreakerHook) admit(ctx context.Context) (context.Context, error) {
+	done, err := h.cb.Allow()
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, redisBreakerDoneKey{}, done), nil
+}
+
+func (h redisBreakerHook) report(ctx context.Context, err error) {
+	if done, ok := ctx.Value(redisBreakerDoneKey{}).(func(error)); ok {
+		done(err)
+	}
+}
@@ -0,0 +1,516 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/handlers"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/handlers/routes"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/seed"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/services"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/bulkhead"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/health"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/tracing"
+)
+
+// Per-component stop budgets; components without one get whatever is left
+// of SHUTDOWN_TIMEOUT
+const (
+	httpStopTimeout      = 15 * time.Second
+	consumersStopTimeout = 10 * time.Second
+)
+
+// App is the service with every dependency wired once. Start brings its
+// components up in order; Stop takes them down in reverse, so nothing is
+// closed while a component started after it may still be using it.
+type App struct {
+	// Mode is the run mode: which of the API and the click consumers run
+	Mode string
+
+	Config   *config.Config
+	Logger   *logger.Logger
+	Database *db.Database
+
+	// Circuit Breakers, one per dependency
+	Breakers *breaker.Registry
+
+	AdsRepo     *repo.AdsRepository
+	AdsService  *services.AdsService
+	NATSService *services.NATSService
+
+	// Liveness and readiness probes
+	Liveness  *health.Checker
+	Readiness *health.Checker
+
+	// HTTP Components; the admin endpoints have a listener of their own
+	Handler     *handlers.Handler
+	Server      *http.Server
+	AdminServer *http.Server
+
+	components []component
+	started    []component
+	serveErr   chan error
+}
+
+// component is one step of the start order. start and stop are optional;
+// stopTimeout bounds stop on top of the overall shutdown budget.
+type component struct {
+	name        string
+	start       func() error
+	stop        func(ctx context.Context) error
+	stopTimeout time.Duration
+}
+
+// New reads the configuration and wires the application for mode, or for
+// RUN_MODE when mode is empty; nothing runs until Start
+func New(mode string) (*App, error) {
+	cfg := config.NewConfig()
+	if mode == "" {
+		mode = cfg.RunMode
+	}
+	if !config.ValidRunMode(mode) {
+		return nil, fmt.Errorf("unknown run mode %q (all|serve-api|consume)", mode)
+	}
+
+	log, err := logger.NewLogger(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	app := &App{
+		Mode:     mode,
+		Config:   cfg,
+		Logger:   log,
+		serveErr: make(chan error, 1),
+	}
+	if err := app.wire(); err != nil {
+		app.closeConnections()
+		return nil, err
+	}
+	return app, nil
+}
+
+// wire builds the components the run mode needs and registers them in start order
+func (a *App) wire() error {
+	cfg := a.Config
+	serveAPI := a.Mode != config.RunModeConsume
+	consume := a.Mode != config.RunModeServeAPI
+	// API-only nodes leave writing clicks to the consumers unless told otherwise
+	writeClicks := consume || cfg.ServeAPIFallbackWrites
+
+	// Tracing comes first so it is flushed last, after every span has ended
+	shutdownTracing, err := tracing.Init(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+	a.add(component{name: "tracing", stop: shutdownTracing})
+
+	// Keep per-ad click series bounded however many ads there are
+	metrics.Default().LimitAdLabels(cfg.MetricsAdLabelTopK, cfg.MetricsAdLabelAllowlist, cfg.MetricsAdLabelRefresh)
+
+	// Connect to the database
+	database, err := db.NewDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	a.Database = database
+	a.add(component{name: "postgres", stop: func(context.Context) error { return database.ClosePostgres() }})
+	a.add(component{name: "redis", stop: func(context.Context) error { return database.CloseRedis() }})
+
+	// Demo data for empty databases, as SEED_MODE says; never in prod
+	if err := seedDatabase(cfg, database); err != nil {
+		return fmt.Errorf("failed to seed database: %w", err)
+	}
+
+	// One circuit breaker per dependency
+	a.Breakers = newBreakerRegistry(cfg, a.Logger)
+	database.GuardRedis(a.Breakers.Get(breakerRedis, breaker.WithIsFailure(db.IsRedisFailure)))
+
+	a.AdsRepo = repo.NewAdsRepository(database.PostgresDB, repoGuards(cfg, a.Breakers))
+
+	// Select how click batches are written (multi-row INSERT or COPY)
+	clickWriter, err := repo.NewClickWriter(a.AdsRepo, cfg.ClickWriter)
+	if err != nil {
+		return fmt.Errorf("failed to create click writer: %w", err)
+	}
+
+	natsService, err := services.NewNATSService(cfg.NATSURL, a.Breakers.Get(breakerNATS), a.Logger)
+	if err != nil && a.Mode == config.RunModeConsume {
+		return fmt.Errorf("consumer needs NATS: %w", err)
+	}
+	if err != nil && !writeClicks {
+		return fmt.Errorf("serve-api needs NATS without SERVE_API_FALLBACK_WRITES: %w", err)
+	}
+	if err != nil {
+		a.Logger.Logger.Warnf("NATS service initialization failed: %v", err)
+		// Continue without NATS - application will work in direct mode
+	} else {
+		a.NATSService = natsService
+		a.add(component{name: "nats", stop: func(context.Context) error { return natsService.Close() }})
+	}
+
+	// Fallbacks while Postgres is unavailable, on the nodes that write clicks
+	var spool *services.ClickSpool
+	if writeClicks {
+		if spool, err = newClickSpool(cfg); err != nil {
+			return err
+		}
+	}
+	cache := services.NewAnalyticsCache(database.RedisDB, cfg.AnalyticsCacheTTL)
+
+	// With fallback writes on, API-only nodes run the batcher too: it
+	// persists clicks NATS won't take
+	a.AdsService = services.NewAdsService(a.AdsRepo, clickWriter, services.NewBatchConfig(cfg), spool, cache, a.Logger, a.NATSService, writeClicks)
+	if writeClicks {
+		a.add(component{
+			name: "batcher",
+			start: func() error {
+				a.AdsService.StartBatchProcessor()
+				return nil
+			},
+			stop: a.AdsService.StopBatchProcessor,
+		})
+	}
+
+	// Storage upkeep belongs to the nodes that persist clicks
+	if consume {
+		// Keep clicks partitions ahead of time and enforce retention
+		a.add(background("partitions", func(ctx context.Context) {
+			database.Partitions.StartMaintenance(ctx, time.Hour)
+		}))
+
+		// Detect (and optionally repair) Ad.TotalClicks drift
+		reconciler := services.NewReconcileService(a.AdsRepo, cfg.ClicksRetentionDays, a.Logger)
+		a.add(background("reconciler", func(ctx context.Context) {
+			reconciler.StartReconciler(ctx, cfg.ReconcileInterval, cfg.ReconcileAutoFix)
+		}))
+	}
+
+	if consume && a.NATSService != nil {
+		clickService := services.NewClickService(a.AdsService)
+		a.add(component{
+			name: "consumers",
+			start: func() error {
+				err := a.NATSService.StartConsumer(clickService, cfg.NATSConsumerWorkers)
+				if err != nil && a.Mode == config.RunModeConsume {
+					return err
+				}
+				if err != nil {
+					// Not fatal: clicks are processed directly instead
+					a.Logger.Logger.Errorf("Failed to start NATS consumer: %v", err)
+				}
+				return nil
+			},
+			stop:        a.NATSService.StopConsumers,
+			stopTimeout: consumersStopTimeout,
+		})
+	}
+
+	// Liveness and readiness probes
+	// NATS is critical wherever there is no other way to persist clicks
+	a.Liveness, a.Readiness = newHealthCheckers(cfg, database, a.Breakers, a.NATSService, a.AdsService, a.Mode == config.RunModeConsume || !writeClicks)
+
+	a.Handler = handlers.NewHandler(a.AdsService, a.Breakers, a.Liveness, a.Readiness, a.Logger)
+	httpIngest, httpAnalytics := routeBulkheads(cfg)
+	router := routes.NewRouter(a.Handler, httpIngest, httpAnalytics, cfg.HTTPRequestTimeout, cfg.OTELServiceName)
+
+	// Consumer nodes still serve probes and metrics
+	var engine http.Handler
+	if serveAPI {
+		engine = router.SetupRoutes(a.Logger)
+	} else {
+		engine = router.SetupSystemRoutes(a.Logger)
+	}
+
+	a.Server = &http.Server{
+		Addr:         fmt.Sprintf(":%s", cfg.HttpPort),
+		Handler:      engine,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// Admin endpoints stay off the public listener, and up until the API
+	// listener has drained; callers need a key from `adsmetrics apikey create`
+	apiKeys := services.NewAPIKeyService(a.AdsRepo)
+	a.AdminServer = &http.Server{
+		Addr:         net.JoinHostPort(cfg.AdminHost, cfg.AdminPort),
+		Handler:      router.SetupAdminRoutes(a.Logger, apiKeys.Verify),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	a.add(component{
+		name:  "admin_http",
+		start: func() error { return a.serve(a.AdminServer) },
+		stop:  a.AdminServer.Shutdown,
+	})
+	a.add(component{
+		name:        "http",
+		start:       func() error { return a.serve(a.Server) },
+		stop:        a.stopHTTP,
+		stopTimeout: httpStopTimeout,
+	})
+
+	a.Logger.Logger.Infof("Wired %s mode", a.Mode)
+	return nil
+}
+
+func (a *App) add(c component) {
+	a.components = append(a.components, c)
+}
+
+// background is a component running fn's goroutines until it is stopped
+func background(name string, fn func(ctx context.Context)) component {
+	var cancel context.CancelFunc
+	return component{
+		name: name,
+		start: func() error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			fn(ctx)
+			return nil
+		},
+		stop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	}
+}
+
+// serve binds server's listener before returning so a port conflict fails
+// Start
+func (a *App) serve(server *http.Server) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
+	a.Logger.Logger.Infof("Server starting on %s", server.Addr)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case a.serveErr <- err:
+			default: // the other server already failed
+			}
+		}
+	}()
+	return nil
+}
+
+// stopHTTP finishes in-flight requests, then the clicks they handed off
+func (a *App) stopHTTP(ctx context.Context) error {
+	if err := a.Server.Shutdown(ctx); err != nil {
+		return err
+	}
+	return a.Handler.Wait(ctx)
+}
+
+// Start starts every component in order. If one fails, the ones already
+// started are stopped again.
+func (a *App) Start() error {
+	for _, c := range a.components {
+		if c.start != nil {
+			if err := c.start(); err != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+				defer cancel()
+				a.stopStarted(ctx)
+				return fmt.Errorf("failed to start %s: %w", c.name, err)
+			}
+		}
+		a.started = append(a.started, c)
+		a.Logger.Logger.Infof("Started %s", c.name)
+	}
+	return nil
+}
+
+// Stop takes the service out of rotation, waits SHUTDOWN_DRAIN_DELAY for
+// traffic to move elsewhere, then stops the components in reverse start order
+func (a *App) Stop(ctx context.Context) error {
+	a.Logger.Logger.Info("Starting graceful shutdown...")
+
+	a.Readiness.Drain()
+	if delay := a.Config.ShutdownDrainDelay; delay > 0 {
+		a.Logger.Logger.Infof("Draining traffic for %s", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	err := a.stopStarted(ctx)
+	a.Logger.Logger.Info("Graceful shutdown completed")
+	return err
+}
+
+func (a *App) stopStarted(ctx context.Context) error {
+	var errs []error
+	for i := len(a.started) - 1; i >= 0; i-- {
+		c := a.started[i]
+		if c.stop == nil {
+			continue
+		}
+
+		stopCtx, cancel := ctx, context.CancelFunc(func() {})
+		if c.stopTimeout > 0 {
+			stopCtx, cancel = context.WithTimeout(ctx, c.stopTimeout)
+		}
+		start := time.Now()
+		err := c.stop(stopCtx)
+		cancel()
+
+		if err != nil {
+			a.Logger.Logger.Errorf("Failed to stop %s: %v", c.name, err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.name, err))
+			continue
+		}
+		a.Logger.Logger.Infof("Stopped %s in %s", c.name, time.Since(start).Round(time.Millisecond))
+	}
+	a.started = nil
+	return errors.Join(errs...)
+}
+
+// closeConnections releases what wire opened when wiring fails half way
+func (a *App) closeConnections() {
+	if a.NATSService != nil {
+		a.NATSService.Close()
+	}
+	if a.Database != nil {
+		a.Database.Close()
+	}
+}
+
+// Run starts the application and stops it when ctx is done or the HTTP
+// server fails
+func (a *App) Run(ctx context.Context) error {
+	if err := a.Start(); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		a.Logger.Logger.Info("Shutdown signal received")
+	case runErr = <-a.serveErr:
+		a.Logger.Logger.Errorf("HTTP server failed: %v", runErr)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+	if err := a.Stop(stopCtx); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
+}
+
+// HealthCheck runs the readiness checks and reports the first critical failure
+func (a *App) HealthCheck(ctx context.Context) error {
+	report := a.Readiness.Run(ctx)
+	if report.OK() {
+		return nil
+	}
+	for _, check := range report.Checks {
+		if check.Critical && check.Status != health.StatusUp {
+			return fmt.Errorf("%s health check failed: %s", check.Name, check.Error)
+		}
+	}
+	return fmt.Errorf("service is %s", report.Status)
+}
+
+// seedDatabase seeds an empty database with the data set SEED_MODE names
+func seedDatabase(cfg *config.Config, database *db.Database) error {
+	seeder := seed.NewSeeder(database.PostgresDB, cfg.SeedRandomSeed)
+	switch cfg.SeedMode {
+	case config.SeedModeSample:
+		return seeder.SeedAll()
+	case config.SeedModeTest:
+		return seeder.SeedTestData()
+	default:
+		return nil
+	}
+}
+
+// Circuit breaker names, one per dependency
+const (
+	breakerPostgres = "postgres"
+	breakerRedis    = "redis"
+	breakerNATS     = "nats"
+)
+
+// newBreakerRegistry creates the registry every dependency's breaker comes
+// from, sharing the configured thresholds and transition logging
+func newBreakerRegistry(cfg *config.Config, log *logger.Logger) *breaker.Registry {
+	return breaker.NewRegistry(breaker.Settings{
+		Window:                cfg.BreakerWindow,
+		WindowCalls:           cfg.BreakerWindowCalls,
+		MinimumRequests:       cfg.BreakerMinRequests,
+		FailureRateThreshold:  cfg.BreakerFailureRate,
+		SlowCallThreshold:     cfg.BreakerSlowCallThreshold,
+		SlowCallRateThreshold: cfg.BreakerSlowCallRate,
+		OpenTimeout:           cfg.BreakerOpenTimeout,
+		HalfOpenMaxCalls:      cfg.BreakerHalfOpenMaxCalls,
+		OnStateChange:         logBreakerTransition(log),
+	})
+}
+
+// postgresBreaker returns the breaker guarding Postgres. Only transient errors
+// count against it: a bad row says nothing about whether Postgres is healthy,
+// and neither does a client that hung up mid-query.
+func postgresBreaker(breakers *breaker.Registry) *breaker.CircuitBreaker {
+	return breakers.Get(breakerPostgres, breaker.WithIsFailure(func(err error) bool {
+		return !errors.Is(err, context.Canceled) && repo.IsTransientError(err)
+	}))
+}
+
+// logBreakerTransition emits a structured log event for every breaker state change
+func logBreakerTransition(log *logger.Logger) breaker.StateChangeFunc {
+	return func(name string, from, to breaker.State) {
+		if to == breaker.StateOpen {
+			log.Logger.Warnw("Circuit breaker opened", "breaker", name, "from", from.String(), "to", to.String())
+			return
+		}
+		log.Logger.Infow("Circuit breaker state changed", "breaker", name, "from", from.String(), "to", to.String())
+	}
+}
+
+// repoGuards bounds repository queries: the Postgres breaker, the pool split
+// between ingestion writes and analytics reads, and per-operation timeouts
+func repoGuards(cfg *config.Config, breakers *breaker.Registry) repo.Guards {
+	return repo.Guards{
+		Breaker:      postgresBreaker(breakers),
+		Writes:       bulkhead.New("db_write", cfg.DBWriteConcurrency, cfg.DBQueueTimeout),
+		Reads:        bulkhead.New("db_read", cfg.DBReadConcurrency, cfg.DBQueueTimeout),
+		QueryTimeout: cfg.DBQueryTimeout,
+		BatchTimeout: cfg.DBBatchTimeout,
+	}
+}
+
+// routeBulkheads caps concurrent requests to the ingestion and analytics routes
+func routeBulkheads(cfg *config.Config) (ingest, analytics *bulkhead.Bulkhead) {
+	ingest = bulkhead.New("http_ingest", cfg.HTTPIngestConcurrency, cfg.HTTPQueueTimeout)
+	analytics = bulkhead.New("http_analytics", cfg.HTTPAnalyticsConcurrency, cfg.HTTPQueueTimeout)
+	return ingest, analytics
+}
+
+// newClickSpool opens the disk spool clicks fall back to while Postgres is
+// unavailable; nil when SPOOL_DIR is empty
+func newClickSpool(cfg *config.Config) (*services.ClickSpool, error) {
+	if cfg.SpoolDir == "" {
+		return nil, nil
+	}
+	spool, err := services.NewClickSpool(cfg.SpoolDir, cfg.SpoolMaxBytes, cfg.BatchMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open click spool: %w", err)
+	}
+	return spool, nil
+}
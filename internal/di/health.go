@@ -0,0 +1,107 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/db"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/services"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/health"
+)
+
+// newHealthCheckers builds the liveness and readiness checkers.
+//
+// Liveness only looks at the process itself, so an outage of a dependency
+// never gets the pod restarted: restarting wouldn't fix Postgres, and the
+// spool and caches keep working in the meantime. Readiness covers the
+// dependencies; a critical failure takes the pod out of rotation until it
+// recovers, a non-critical one only reports it as degraded. NATS and its
+// breaker are critical only where clicks are consumed from it or can't be
+// written any other way.
+func newHealthCheckers(cfg *config.Config, database *db.Database, breakers *breaker.Registry,
+	natsService *services.NATSService, adsService *services.AdsService, natsCritical bool) (live, ready *health.Checker) {
+	live = health.NewChecker("liveness", cfg.HealthCheckTimeout, cfg.HealthCacheTTL)
+	live.Register(health.Check{
+		Name:     "batch_writer",
+		Critical: true,
+		Fn: func(ctx context.Context) error {
+			heartbeat := adsService.BatchWriterHeartbeat()
+			if heartbeat.IsZero() {
+				return nil // not started yet
+			}
+			if stalled := time.Since(heartbeat); stalled > cfg.HealthWriterStallTimeout {
+				return fmt.Errorf("batch writer has not made progress for %s", stalled.Round(time.Second))
+			}
+			return nil
+		},
+	})
+
+	ready = health.NewChecker("readiness", cfg.HealthCheckTimeout, cfg.HealthCacheTTL)
+	ready.Register(health.Check{
+		Name:     "postgres",
+		Critical: true,
+		Fn:       database.PingPostgres,
+	})
+	ready.Register(health.Check{
+		Name: "redis",
+		Fn:   database.PingRedis,
+	})
+	ready.Register(health.Check{
+		Name:     "nats",
+		Critical: natsCritical,
+		Fn: func(ctx context.Context) error {
+			if natsService == nil {
+				return errors.New("not connected, clicks are processed directly")
+			}
+			return natsService.Health()
+		},
+	})
+	ready.Register(health.Check{
+		Name: "replication_lag",
+		Fn: func(ctx context.Context) error {
+			lag, err := database.ReplicationLag(ctx)
+			if err != nil {
+				return err
+			}
+			if lag > cfg.HealthMaxReplicationLag {
+				return fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), cfg.HealthMaxReplicationLag)
+			}
+			return nil
+		},
+	})
+	ready.Register(health.Check{
+		Name:     "batch_backlog",
+		Critical: true,
+		Fn: func(ctx context.Context) error {
+			queued, capacity := adsService.BatchBacklog()
+			if float64(queued) >= cfg.HealthMaxBatchBacklog*float64(capacity) {
+				return fmt.Errorf("%d of %d click queue slots in use", queued, capacity)
+			}
+			return nil
+		},
+	})
+
+	// An open Postgres breaker means writes are being spooled and reads
+	// served stale; the other dependencies have fallbacks of their own.
+	// Half-open passes: the pod has to stay in rotation for the probe calls
+	// that close the breaker again.
+	for _, name := range []string{breakerPostgres, breakerRedis, breakerNATS} {
+		cb := breakers.Get(name)
+		ready.Register(health.Check{
+			Name:     "breaker_" + name,
+			Critical: name == breakerPostgres || (name == breakerNATS && natsCritical),
+			Fn: func(ctx context.Context) error {
+				if state := cb.State(); state == breaker.StateOpen {
+					return fmt.Errorf("circuit breaker is %s", state)
+				}
+				return nil
+			},
+		})
+	}
+
+	return live, ready
+}
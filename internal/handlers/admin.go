@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+// ListBreakers godoc
+//	@Summary		List circuit breakers
+//	@Description	Returns the state and call counters of every circuit breaker.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	BreakersResponse
+//	@Router			/admin/breakers [get]
+func (h *Handler) ListBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, BreakersResponse{
+		Breakers:    h.breakers.Snapshots(),
+		GeneratedAt: time.Now(),
+	})
+}
+
+type BreakersResponse struct {
+	Breakers    []breaker.Snapshot `json:"breakers"`
+	GeneratedAt time.Time          `json:"generated_at"`
+}
+
+// ClickLatency godoc
+//	@Summary		Click pipeline latency
+//	@Description	Returns the maximum latency of each click pipeline stage over the last window, plus the latest observation.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	ClickLatencyResponse
+//	@Router			/admin/latency [get]
+func (h *Handler) ClickLatency(c *gin.Context) {
+	c.JSON(http.StatusOK, ClickLatencyResponse{
+		Stages:        metrics.StageLags(),
+		WindowSeconds: metrics.StageLagWindow.Seconds(),
+		GeneratedAt:   time.Now(),
+	})
+}
+
+type ClickLatencyResponse struct {
+	Stages        []metrics.StageLag `json:"stages"`
+	WindowSeconds float64            `json:"window_seconds"`
+	GeneratedAt   time.Time          `json:"generated_at"`
+}
+
+// GetLogLevel godoc
+//	@Summary		Get log level
+//	@Description	Returns the minimum level currently being logged.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	LogLevelResponse
+//	@Router			/admin/log-level [get]
+func (h *Handler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, LogLevelResponse{Level: h.log.Level().String()})
+}
+
+// SetLogLevel godoc
+//	@Summary		Set log level
+//	@Description	Changes the minimum level logged by this process until it restarts.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			level	body		LogLevelRequest	true	"New level: debug, info, warn or error"
+//	@Success		200		{object}	LogLevelResponse
+//	@Failure		400		{object}	map[string]interface{}
+//	@Router			/admin/log-level [put]
+func (h *Handler) SetLogLevel(c *gin.Context) {
+	var request LogLevelRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	previous := h.log.Level()
+	if err := h.log.SetLevel(request.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid log level",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Warn so the change is recorded at any level but error
+	h.log.Logger.Warnw("Log level changed", "from", previous.String(), "to", h.log.Level().String())
+	c.JSON(http.StatusOK, LogLevelResponse{Level: h.log.Level().String()})
+}
+
+type LogLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
@@ -1,30 +1,64 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/middleware"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/services"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/health"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
 	adsService *services.AdsService
+	breakers   *breaker.Registry
+	liveness   *health.Checker
+	readiness  *health.Checker
 	log        *logger.Logger
+
+	// Clicks handed off after the response was sent
+	pending sync.WaitGroup
 }
 
-func NewHandler(adsService *services.AdsService, log *logger.Logger) *Handler {
+func NewHandler(adsService *services.AdsService, breakers *breaker.Registry, liveness, readiness *health.Checker, log *logger.Logger) *Handler {
 	return &Handler{
 		adsService: adsService,
+		breakers:   breakers,
+		liveness:   liveness,
+		readiness:  readiness,
 		log:        log,
 	}
 }
 
+// Wait blocks until every click handed off by PostClick has been processed,
+// or ctx is done
+func (h *Handler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // GetAds godoc
 //	@Summary		Get all ads
 //	@Description	Returns a list of ads with basic metadata.
@@ -32,15 +66,17 @@ func NewHandler(adsService *services.AdsService, log *logger.Logger) *Handler {
 //	@Produce		json
 //	@Success		200	{object}	GetAdsResponse
 //	@Failure		500	{object}	ErrorResponse
+//	@Failure		504	{object}	ErrorResponse
 //	@Router			/ads [get]
 func (h *Handler) GetAds(c *gin.Context) {
 	start := time.Now()
 
-	ads, err := h.adsService.GetAdsAllAds()
+	ads, err := h.adsService.GetAdsAllAds(c.Request.Context())
 	if err != nil {
 		h.log.Logger.Errorf("Failed to get ads: %v", err)
-		metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), "500", time.Since(start).Seconds())
-		c.JSON(http.StatusInternalServerError, gin.H{
+		status := errorStatus(err)
+		metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), strconv.Itoa(status), time.Since(start).Seconds())
+		c.JSON(status, gin.H{
 			"error":   "Failed to fetch ads",
 			"message": err.Error(),
 		})
@@ -78,10 +114,11 @@ func (h *Handler) GetAds(c *gin.Context) {
 //	@Router			/ads/click [post]
 func (h *Handler) PostClick(c *gin.Context) {
 	start := time.Now()
+	log := logger.FromContext(c.Request.Context(), h.log)
 
 	var request ClickRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		h.log.Logger.Errorf("Invalid click request: %v", err)
+		log.Logger.Errorf("Invalid click request: %v", err)
 		metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), "400", time.Since(start).Seconds())
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid request format",
@@ -112,21 +149,33 @@ func (h *Handler) PostClick(c *gin.Context) {
 		IP:            request.IP,
 		VideoPlayTime: request.VideoPlayTime,
 		Timestamp:     time.Now(),
+		IngestedAt:    start,
+		RequestID:     c.GetString(middleware.RequestIDKey),
 	}
 
 	// Use timestamp from request if provided
 	if !request.Timestamp.IsZero() {
 		click.Timestamp = request.Timestamp
 	}
-
-	// Publish to Kafka for asynchronous processing (non-blocking)
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(
+		tracing.AttrClickID.String(click.ID),
+		tracing.AttrAdID.String(click.AdID),
+	)
+
+	// Publish to Kafka for asynchronous processing (non-blocking). The work
+	// outlives the request, so it keeps the request's values but not its
+	// cancellation, and gets its own deadline.
+	log = log.With(logger.FieldClickID, click.ID, logger.FieldAdID, click.AdID)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), services.ClickProcessTimeout)
+	ctx = logger.NewContext(ctx, log)
+	h.pending.Add(1)
 	go func() {
-		if err := h.adsService.PublishClick(click); err != nil {
-			h.log.Logger.Errorf("Failed to publish click to Kafka: %v", err)
-			// Fallback: process directly if Kafka fails
-			if err := h.adsService.ProcessClick(click); err != nil {
-				h.log.Logger.Errorf("Failed to process click directly: %v", err)
-			}
+		defer h.pending.Done()
+		defer cancel()
+		// PublishClick already falls back to processing the click here
+		// where that is allowed
+		if err := h.adsService.PublishClick(ctx, click); err != nil {
+			log.Logger.Errorf("Failed to publish click: %v", err)
 		}
 	}()
 
@@ -150,6 +199,7 @@ func (h *Handler) PostClick(c *gin.Context) {
 //	@Param			timeframe	query		string	false	"Time window (1m, 5m, 15m, 1h, 24h)"
 //	@Success		200			{object}	AnalyticsOverview
 //	@Failure		500			{object}	ErrorResponse
+//	@Failure		504			{object}	ErrorResponse
 //	@Router			/ads/analytics [get]
 func (h *Handler) GetAnalytics(c *gin.Context) {
 	start := time.Now()
@@ -160,11 +210,12 @@ func (h *Handler) GetAnalytics(c *gin.Context) {
 
 	// If specific ad requested
 	if adID != "" {
-		analytics, err := h.adsService.GetAnalytics(adID)
+		analytics, err := h.adsService.GetAnalytics(c.Request.Context(), adID)
 		if err != nil {
 			h.log.Logger.Errorf("Failed to get analytics for ad %s: %v", adID, err)
-			metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), "500", time.Since(start).Seconds())
-			c.JSON(http.StatusInternalServerError, gin.H{
+			status := errorStatus(err)
+			metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), strconv.Itoa(status), time.Since(start).Seconds())
+			c.JSON(status, gin.H{
 				"error":   "Failed to fetch analytics",
 				"message": err.Error(),
 			})
@@ -177,11 +228,12 @@ func (h *Handler) GetAnalytics(c *gin.Context) {
 	}
 
 	// Get analytics for all ads
-	ads, err := h.adsService.GetAdsAllAds()
+	ads, stale, err := h.adsService.GetAdsAllAdsCached(c.Request.Context())
 	if err != nil {
 		h.log.Logger.Errorf("Failed to get ads for analytics: %v", err)
-		metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), "500", time.Since(start).Seconds())
-		c.JSON(http.StatusInternalServerError, gin.H{
+		status := errorStatus(err)
+		metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), strconv.Itoa(status), time.Since(start).Seconds())
+		c.JSON(status, gin.H{
 			"error":   "Failed to fetch analytics",
 			"message": err.Error(),
 		})
@@ -191,11 +243,23 @@ func (h *Handler) GetAnalytics(c *gin.Context) {
 	// Get analytics for each ad
 	analyticsData := make([]services.AnalyticsResponse, 0, len(ads))
 	for _, ad := range ads {
-		analytics, err := h.adsService.GetAnalytics(ad.ID)
+		analytics, err := h.adsService.GetAnalytics(c.Request.Context(), ad.ID)
+		if err != nil && c.Request.Context().Err() != nil {
+			// Out of time; the rest would fail the same way
+			h.log.Logger.Errorf("Analytics overview abandoned: %v", err)
+			status := errorStatus(err)
+			metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), strconv.Itoa(status), time.Since(start).Seconds())
+			c.JSON(status, gin.H{
+				"error":   "Failed to fetch analytics",
+				"message": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			h.log.Logger.Warnf("Failed to get analytics for ad %s: %v", ad.ID, err)
 			continue
 		}
+		stale = stale || analytics.Stale
 		analyticsData = append(analyticsData, *analytics)
 	}
 
@@ -204,25 +268,56 @@ func (h *Handler) GetAnalytics(c *gin.Context) {
 		TimeFrame:   timeFrame,
 		Analytics:   analyticsData,
 		GeneratedAt: time.Now(),
+		Stale:       stale,
 	}
 
 	metrics.RecordHTTPRequest(c.Request.Method, c.FullPath(), "200", time.Since(start).Seconds())
 	c.JSON(http.StatusOK, response)
 }
 
+// errorStatus maps a service error to the status to answer with: a request
+// that ran past its deadline gets 504, anything else 500
+func errorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Health is the liveness probe. It only fails if the process itself is stuck,
+// never because a dependency is down.
 func (h *Handler) Health(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
-		"timestamp": time.Now(),
-		"service":   "ads-metric-tracker",
-	})
+	h.probe(c, h.liveness, "healthy")
 }
 
+// Ready is the readiness probe. It fails while a critical dependency is
+// unavailable or the service is shutting down.
 func (h *Handler) Ready(c *gin.Context) {
-	// You can add actual readiness checks here (database connectivity, etc.)
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "ready",
-		"timestamp": time.Now(),
+	h.probe(c, h.readiness, "ready")
+}
+
+// probe answers 200 or 503 from a checker's report; ?verbose=1 returns the
+// report itself
+func (h *Handler) probe(c *gin.Context, checker *health.Checker, okStatus string) {
+	report := checker.Run(c.Request.Context())
+
+	code := http.StatusOK
+	if !report.OK() {
+		code = http.StatusServiceUnavailable
+	}
+
+	if verbose, _ := strconv.ParseBool(c.Query("verbose")); verbose {
+		c.JSON(code, report)
+		return
+	}
+
+	status := okStatus
+	if report.Status != health.StatusReady {
+		status = report.Status
+	}
+	c.JSON(code, gin.H{
+		"status":    status,
+		"timestamp": report.CheckedAt,
 		"service":   "ads-metric-tracker",
 	})
 }
@@ -253,6 +348,7 @@ type AnalyticsOverview struct {
 	TimeFrame   string                       `json:"timeframe"`
 	Analytics   []services.AnalyticsResponse `json:"analytics"`
 	GeneratedAt time.Time                    `json:"generated_at"`
+	Stale       bool                         `json:"stale"`
 }
 
 type GetAdsResponse struct {
@@ -289,7 +385,7 @@ func (h *Handler) RequestLogger() gin.HandlerFunc {
 		// Log request
 		h.log.Logger.Infof("%s %s - %s (%v)", method, path, statusCode, duration)
 
-		// Record metrics
-		metrics.RecordHTTPRequest(method, path, statusCode, duration.Seconds())
+		// Record metrics by route template, not raw path
+		metrics.RecordHTTPRequest(method, metrics.RouteLabel(c.FullPath()), statusCode, duration.Seconds())
 	}
 }
@@ -1,31 +1,85 @@
 package routes
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	_ "github.com/ratheeshkumar25/adsmetrictracker/docs"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/handlers"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/middleware"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/bulkhead"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 type Router struct {
 	handler *handlers.Handler
+
+	// Concurrency caps for click ingestion and for read/analytics endpoints
+	ingest    *bulkhead.Bulkhead
+	analytics *bulkhead.Bulkhead
+
+	// Deadline for API requests, queueing for a bulkhead slot included
+	requestTimeout time.Duration
+
+	// Service name reported on server spans
+	serviceName string
 }
 
-func NewRouter(handler *handlers.Handler) *Router {
+func NewRouter(handler *handlers.Handler, ingest, analytics *bulkhead.Bulkhead, requestTimeout time.Duration, serviceName string) *Router {
 	return &Router{
-		handler: handler,
+		handler:        handler,
+		ingest:         ingest,
+		analytics:      analytics,
+		requestTimeout: requestTimeout,
+		serviceName:    serviceName,
 	}
 }
 
 func (r *Router) SetupRoutes(log *logger.Logger) *gin.Engine {
+	router := r.newEngine(log)
+
+	// Health and system endpoints
+	r.setupSystemRoutes(router)
+
+	// API v1 routes - ONLY REQUIRED ENDPOINTS
+	r.setupAPIRoutes(router)
+
+	return router
+}
+
+// SetupSystemRoutes serves only the health and metrics endpoints, for
+// processes that don't serve the API
+func (r *Router) SetupSystemRoutes(log *logger.Logger) *gin.Engine {
+	router := r.newEngine(log)
+	r.setupSystemRoutes(router)
+	return router
+}
+
+// SetupAdminRoutes serves the operational endpoints, which can change how
+// the process runs. They get an engine of their own, for a listener that
+// isn't exposed the way the API is, no CORS (browsers on other origins have
+// no business calling them) and require an API key.
+func (r *Router) SetupAdminRoutes(log *logger.Logger, verifyKey middleware.KeyVerifier) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(middleware.RequestLogger(log))
+	router.Use(middleware.SecurityHeaders())
+	router.Use(middleware.APIKeyAuth(verifyKey))
+
+	r.setupAdminRoutes(router)
+	return router
+}
+
+func (r *Router) newEngine(log *logger.Logger) *gin.Engine {
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
@@ -33,20 +87,24 @@ func (r *Router) SetupRoutes(log *logger.Logger) *gin.Engine {
 
 	// Add middleware
 	router.Use(gin.Recovery())
+	router.Use(otelgin.Middleware(r.serviceName, otelgin.WithFilter(tracedRequest)))
 	router.Use(middleware.RequestLogger(log))
 	router.Use(r.corsMiddleware())
 	router.Use(middleware.SecurityHeaders())
 	router.Use(middleware.RateLimiter())
 
-	// Health and system endpoints
-	r.setupSystemRoutes(router)
-
-	// API v1 routes - ONLY REQUIRED ENDPOINTS
-	r.setupAPIRoutes(router)
-
 	return router
 }
 
+// tracedRequest leaves probes and Prometheus scrapes out of traces
+func tracedRequest(req *http.Request) bool {
+	switch req.URL.Path {
+	case "/health", "/ready", "/metrics":
+		return false
+	}
+	return true
+}
+
 func (r *Router) setupSystemRoutes(router *gin.Engine) {
 	// Health check
 	router.GET("/health", r.handler.Health)
@@ -55,7 +113,7 @@ func (r *Router) setupSystemRoutes(router *gin.Engine) {
 	router.GET("/ready", r.handler.Ready)
 
 	// Metrics endpoint for Prometheus
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/metrics", gin.WrapH(metrics.Default().Handler()))
 
 	// Swagger documentation with proper configuration
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler,
@@ -76,10 +134,22 @@ func (r *Router) setupSystemRoutes(router *gin.Engine) {
 }
 
 func (r *Router) setupAPIRoutes(router *gin.Engine) {
-	// Core API endpoints as per requirements
-	router.GET("/ads", r.handler.GetAds)                 // R: GET /ads
-	router.POST("/ads/click", r.handler.PostClick)       // R: POST /ads/click
-	router.GET("/ads/analytics", r.handler.GetAnalytics) // R: GET /ads/analytics
+	// Core API endpoints as per requirements, in separate bulkheads so slow
+	// analytics can't hold up click ingestion
+	ingest := router.Group("", middleware.Timeout(r.requestTimeout), middleware.Bulkhead(r.ingest))
+	ingest.POST("/ads/click", r.handler.PostClick) // R: POST /ads/click
+
+	analytics := router.Group("", middleware.Timeout(r.requestTimeout), middleware.Bulkhead(r.analytics))
+	analytics.GET("/ads", r.handler.GetAds)                 // R: GET /ads
+	analytics.GET("/ads/analytics", r.handler.GetAnalytics) // R: GET /ads/analytics
+}
+
+func (r *Router) setupAdminRoutes(router *gin.Engine) {
+	admin := router.Group("/admin")
+	admin.GET("/breakers", r.handler.ListBreakers)
+	admin.GET("/latency", r.handler.ClickLatency)
+	admin.GET("/log-level", r.handler.GetLogLevel)
+	admin.PUT("/log-level", r.handler.SetLogLevel)
 }
 
 func (r *Router) corsMiddleware() gin.HandlerFunc {
@@ -1,13 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/bulkhead"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
@@ -29,6 +35,13 @@ func RequestLogger(log *logger.Logger) gin.HandlerFunc {
 		c.Set(RequestIDKey, requestID)
 		c.Header(RequestIDKey, requestID)
 
+		// Tie the request's span to its request ID
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(tracing.AttrRequestID.String(requestID))
+
+		// Everything the request leads to logs with its ID
+		reqLog := log.With(logger.FieldRequestID, requestID)
+		c.Request = c.Request.WithContext(logger.NewContext(c.Request.Context(), reqLog))
+
 		c.Next()
 
 		// Calculate request duration
@@ -39,6 +52,7 @@ func RequestLogger(log *logger.Logger) gin.HandlerFunc {
 		// Log request
 		log.Logger.Infow("HTTP Request",
 			"request_id", requestID,
+			"trace_id", tracing.TraceID(c.Request.Context()),
 			"method", method,
 			"path", path,
 			"status", statusCode,
@@ -46,8 +60,8 @@ func RequestLogger(log *logger.Logger) gin.HandlerFunc {
 			"ip", c.ClientIP(),
 			"user_agent", c.GetHeader("User-Agent"))
 
-		// Record metrics
-		metrics.RecordHTTPRequest(method, path, statusStr, duration.Seconds())
+		// Record metrics by route template, not raw path
+		metrics.RecordHTTPRequest(method, metrics.RouteLabel(c.FullPath()), statusStr, duration.Seconds())
 	}
 }
 
@@ -90,6 +104,72 @@ func RateLimiter() gin.HandlerFunc {
 	}
 }
 
+// KeyVerifier reports whether an API key is valid; an error means it couldn't
+// be checked
+type KeyVerifier func(ctx context.Context, key string) (bool, error)
+
+// APIKeyAuth middleware admits only requests carrying a valid API key, as
+// "Authorization: Bearer <key>" or "X-API-Key: <key>"
+func APIKeyAuth(verify KeyVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+
+		valid, err := verify(c.Request.Context(), key)
+		if err != nil {
+			c.AbortWithStatusJSON(503, gin.H{
+				"error":   "Service unavailable",
+				"message": "The API key could not be verified. Please try again later.",
+			})
+			return
+		}
+		if !valid {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(401, gin.H{
+				"error":   "Unauthorized",
+				"message": "A valid API key is required.",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Bulkhead middleware caps concurrent requests for a route group, answering
+// 503 when no slot frees up within the bulkhead's queueing timeout
+func Bulkhead(b *bulkhead.Bulkhead) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		release, err := b.Acquire(c.Request.Context())
+		if errors.Is(err, context.DeadlineExceeded) {
+			// The request's own deadline ran out while it queued
+			c.AbortWithStatusJSON(504, gin.H{
+				"error":   "Request timed out",
+				"message": "No capacity freed up before the request's deadline.",
+			})
+			return
+		}
+		if errors.Is(err, context.Canceled) {
+			// The client went away; 499, as nginx logs it, keeps this out of
+			// the server error counts
+			c.AbortWithStatus(499)
+			return
+		}
+		if err != nil {
+			c.Header("Retry-After", "1")
+			c.JSON(503, gin.H{
+				"error":   "Service busy",
+				"message": "Too many concurrent requests. Please try again later.",
+			})
+			c.Abort()
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
+
 // ErrorHandler middleware for handling panics and errors
 func ErrorHandler(log *logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -110,11 +190,27 @@ func ErrorHandler(log *logger.Logger) gin.HandlerFunc {
 	}
 }
 
-// Timeout middleware for request timeout
+// Timeout middleware gives each request a deadline. Handlers pass the request
+// context down to the database, so running out of time cancels their queries;
+// a request nothing has answered by then gets 504.
 func Timeout(timeout time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Set timeout in context
-		c.Set("timeout", timeout)
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
 		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			c.AbortWithStatusJSON(504, gin.H{
+				"error":   "Request timed out",
+				"message": "The request took longer than " + timeout.String() + ".",
+			})
+		}
 	}
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type APIKey struct {
+	ID        string     `gorm:"type:char(36);primaryKey;column:id" json:"id"`
+	Name      string     `gorm:"type:varchar(255);not null;column:name" json:"name"`
+	Prefix    string     `gorm:"type:varchar(16);not null;column:prefix" json:"prefix"` // First characters of the key, for identification
+	KeyHash   string     `gorm:"type:char(64);not null;column:key_hash" json:"-"`       // SHA-256 of the key; the key itself is never stored
+	CreatedAt time.Time  `gorm:"autoCreateTime;column:created_at" json:"created_at"`
+	RevokedAt *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+}
+
+func (APIKey) TableName() string { return "api_keys" }
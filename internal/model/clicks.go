@@ -8,5 +8,13 @@ type Clicks struct {
 	Ad            Ad        `gorm:"foreignKey:AdID;references:ID"`                 // No column needed
 	IP            string    `gorm:"type:varchar(45);not null;column:ip" json:"ip"` // Changed to varchar(45)
 	VideoPlayTime int       `gorm:"not null;column:playback_time" json:"playback_time"`
-	Timestamp     time.Time `gorm:"not null;column:timestamp" json:"timestamp"`
+	Timestamp     time.Time `gorm:"primaryKey;not null;column:timestamp" json:"timestamp"` // Partition key, so part of the primary key
+
+	// Pipeline timings for latency metrics, carried in NATS headers and spool
+	// records, never in the click's own JSON
+	IngestedAt time.Time `gorm:"-" json:"-"` // accepted by the API
+	ConsumedAt time.Time `gorm:"-" json:"-"` // picked up from NATS
+
+	// ID of the API request the click came in with, for logs only
+	RequestID string `gorm:"-" json:"-"`
 }
@@ -1,19 +1,59 @@
 package repo
 
-import "github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+import (
+	"context"
+	"strings"
 
-func (r *AdsRepository) FetchAdsAll() ([]model.Ad, error) {
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+)
+
+func (r *AdsRepository) FetchAdsAll(ctx context.Context) ([]model.Ad, error) {
 	var ads []model.Ad
-	if err := r.DB.Preload("Clicks").Find(&ads).Error; err != nil {
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Preload("Clicks").Find(&ads).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return ads, nil
 }
 
-func (r *AdsRepository) CountAds() (int, error) {
+func (r *AdsRepository) CountAds(ctx context.Context) (int, error) {
 	var count int64
-	if err := r.DB.Model(&model.Ad{}).Count(&count).Error; err != nil {
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Model(&model.Ad{}).Count(&count).Error
+	})
+	if err != nil {
 		return 0, err
 	}
 	return int(count), nil
 }
+
+// UpsertAds creates ads or updates the URLs of existing ones, restoring any
+// that were deleted. Click counters are left alone.
+func (r *AdsRepository) UpsertAds(ctx context.Context, ads []model.Ad) error {
+	if len(ads) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	args := make([]interface{}, 0, len(ads)*3)
+
+	sb.WriteString("INSERT INTO ads (id, image_url, target_url, created_at, updated_at, total_clicks) VALUES ")
+	for i, ad := range ads {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?, ?, now(), now(), 0)")
+		args = append(args, ad.ID, ad.ImageURL, ad.TargetURL)
+	}
+	sb.WriteString(` ON CONFLICT (id) DO UPDATE SET
+		image_url = EXCLUDED.image_url,
+		target_url = EXCLUDED.target_url,
+		updated_at = now(),
+		deleted_at = NULL`)
+
+	return r.guardBatch(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Exec(sb.String(), args...).Error
+	})
+}
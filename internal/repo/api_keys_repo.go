@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+)
+
+// CreateAPIKey stores a new API key record
+func (r *AdsRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	return r.guardWrite(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Create(key).Error
+	})
+}
+
+// RevokeAPIKeys revokes the active keys whose ID or prefix is idOrPrefix and
+// returns how many were revoked
+func (r *AdsRepository) RevokeAPIKeys(ctx context.Context, idOrPrefix string) (int, error) {
+	var revoked int64
+	err := r.guardWrite(ctx, func(ctx context.Context) error {
+		result := r.DB.WithContext(ctx).Model(&model.APIKey{}).
+			Where("(id = ? OR prefix = ?) AND revoked_at IS NULL", idOrPrefix, idOrPrefix).
+			Update("revoked_at", time.Now().UTC())
+		revoked = result.RowsAffected
+		return result.Error
+	})
+	return int(revoked), err
+}
+
+// IsActiveAPIKey reports whether an unrevoked key with this hash exists
+func (r *AdsRepository) IsActiveAPIKey(ctx context.Context, keyHash string) (bool, error) {
+	var count int64
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Model(&model.APIKey{}).
+			Where("key_hash = ? AND revoked_at IS NULL", keyHash).
+			Count(&count).Error
+	})
+	return count > 0, err
+}
+
+// ListAPIKeys returns every API key, revoked ones included, oldest first
+func (r *AdsRepository) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Order("created_at").Find(&keys).Error
+	})
+	return keys, err
+}
@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+)
+
+// Click writer implementations selectable through CLICK_WRITER
+const (
+	ClickWriterInsert = "insert"
+	ClickWriterCopy   = "copy"
+)
+
+// ClickWriter persists a batch of clicks together with the matching
+// ads.total_clicks increments and returns the IDs of the clicks that were
+// new; clicks already stored are left out
+type ClickWriter interface {
+	WriteClicks(ctx context.Context, clicks []model.Clicks) (inserted []string, err error)
+	Name() string
+}
+
+// NewClickWriter returns the click writer named by kind
+func NewClickWriter(r *AdsRepository, kind string) (ClickWriter, error) {
+	switch kind {
+	case ClickWriterInsert, "":
+		return &insertClickWriter{repo: r}, nil
+	case ClickWriterCopy:
+		return &copyClickWriter{repo: r}, nil
+	default:
+		return nil, fmt.Errorf("unknown click writer %q", kind)
+	}
+}
+
+// insertClickWriter uses multi-row INSERT statements via SaveBatchAds
+type insertClickWriter struct {
+	repo *AdsRepository
+}
+
+func (w *insertClickWriter) WriteClicks(ctx context.Context, clicks []model.Clicks) ([]string, error) {
+	return w.repo.SaveBatchAds(ctx, clicks)
+}
+
+func (w *insertClickWriter) Name() string { return ClickWriterInsert }
+
+// copyClickWriter streams the batch with COPY via CopyBatchAds
+type copyClickWriter struct {
+	repo *AdsRepository
+}
+
+func (w *copyClickWriter) WriteClicks(ctx context.Context, clicks []model.Clicks) ([]string, error) {
+	return w.repo.CopyBatchAds(ctx, clicks)
+}
+
+func (w *copyClickWriter) Name() string { return ClickWriterCopy }
+
+var clickCopyColumns = []string{"id", "ad_id", "ip", "playback_time", "timestamp"}
+
+// CopyBatchAds streams clicks into a temporary staging table with COPY and
+// merges the ones whose ID it can claim in click_ids into clicks, bumping
+// total_clicks by the rows actually inserted. Semantics match SaveBatchAds; throughput is
+// considerably higher for large batches.
+func (r *AdsRepository) CopyBatchAds(ctx context.Context, clicks []model.Clicks) ([]string, error) {
+	if len(clicks) == 0 {
+		return nil, nil
+	}
+
+	var inserted []string
+	err := r.guardBatch(ctx, func(ctx context.Context) error {
+		var err error
+		inserted, err = r.copyBatch(ctx, clicks)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to copy click batch: %v", err)
+		return nil, err
+	}
+
+	return inserted, nil
+}
+
+func (r *AdsRepository) copyBatch(ctx context.Context, clicks []model.Clicks) ([]string, error) {
+	sqlDB, err := r.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var inserted []string
+	err = conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY needs the pgx driver, got %T", driverConn)
+		}
+		pgxConn := stdConn.Conn()
+
+		tx, err := pgxConn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback(ctx) }() // no-op after commit
+
+		if _, err := tx.Exec(ctx, "CREATE TEMP TABLE clicks_staging (LIKE clicks INCLUDING DEFAULTS) ON COMMIT DROP"); err != nil {
+			return fmt.Errorf("failed to create staging table: %w", err)
+		}
+
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"clicks_staging"}, clickCopyColumns,
+			pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+				c := clicks[i]
+				return []any{c.ID, c.AdID, c.IP, c.VideoPlayTime, c.Timestamp}, nil
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to copy clicks into staging table: %w", err)
+		}
+
+		rows, err := tx.Query(ctx, `WITH claimed AS (
+				INSERT INTO click_ids (id, timestamp)
+				SELECT DISTINCT ON (id) id, timestamp FROM clicks_staging ORDER BY id, timestamp
+				ON CONFLICT (id) DO NOTHING
+				RETURNING id, timestamp
+			)
+			INSERT INTO clicks (id, ad_id, ip, playback_time, timestamp)
+			SELECT DISTINCT ON (s.id) s.id, s.ad_id, s.ip, s.playback_time, s.timestamp
+			FROM clicks_staging s
+			JOIN claimed c ON c.id = s.id AND c.timestamp = s.timestamp
+			ORDER BY s.id
+			ON CONFLICT (id, timestamp) DO NOTHING
+			RETURNING id, ad_id`)
+		if err != nil {
+			return fmt.Errorf("failed to merge staged clicks: %w", err)
+		}
+
+		perAd := make(map[string]int)
+		for rows.Next() {
+			var id, adID string
+			if err := rows.Scan(&id, &adID); err != nil {
+				rows.Close()
+				return err
+			}
+			perAd[adID]++
+			inserted = append(inserted, strings.TrimRight(id, " "))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to merge staged clicks: %w", err)
+		}
+
+		// Update in a stable order so concurrent writers can't deadlock on ads rows
+		adIDs := make([]string, 0, len(perAd))
+		for adID := range perAd {
+			adIDs = append(adIDs, adID)
+		}
+		sort.Strings(adIDs)
+
+		for _, adID := range adIDs {
+			if _, err := tx.Exec(ctx, "UPDATE ads SET total_clicks = total_clicks + $1 WHERE id = $2", perAd[adID], adID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inserted, nil
+}
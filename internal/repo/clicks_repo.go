@@ -1,74 +1,355 @@
 package repo
 
 import (
+	"context"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
 	"gorm.io/gorm"
 )
 
-func (r *AdsRepository) SaveBatchAds(clicks []model.Clicks) error {
-	if err := r.DB.CreateInBatches(&clicks, 500).Error; err != nil {
-		log.Printf("Failed to save click event: %v", err)
-		return err
+// clickInsertChunk keeps each INSERT well under Postgres' 65535 bind parameter limit
+const clickInsertChunk = 500
+
+// SaveBatchAds persists a batch of clicks and bumps each ad's total_clicks by
+// the number of rows actually inserted, all in a single transaction, and
+// returns the IDs of the inserted clicks. Clicks that already exist (e.g.
+// redelivered by NATS) are skipped, so replaying a batch never double counts.
+// A click is identified by its ID alone: each ID is claimed in click_ids
+// first, since the partitioned table's primary key also includes timestamp.
+func (r *AdsRepository) SaveBatchAds(ctx context.Context, clicks []model.Clicks) ([]string, error) {
+	var inserted []string
+
+	err := r.guardBatch(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			perAd := make(map[string]int)
+
+			for i := 0; i < len(clicks); i += clickInsertChunk {
+				end := i + clickInsertChunk
+				if end > len(clicks) {
+					end = len(clicks)
+				}
+
+				claimed, err := claimClickIDs(tx, clicks[i:end])
+				if err != nil {
+					return err
+				}
+				if len(claimed) == 0 {
+					continue
+				}
+
+				rows, err := insertClicksIgnoringDuplicates(tx, claimed)
+				if err != nil {
+					return err
+				}
+				for _, row := range rows {
+					perAd[row.AdID]++
+					inserted = append(inserted, strings.TrimRight(row.ID, " "))
+				}
+			}
+
+			// Update in a stable order so concurrent writers can't deadlock on ads rows
+			adIDs := make([]string, 0, len(perAd))
+			for adID := range perAd {
+				adIDs = append(adIDs, adID)
+			}
+			sort.Strings(adIDs)
+
+			for _, adID := range adIDs {
+				err := tx.Model(&model.Ad{}).
+					Where("id = ?", adID).
+					UpdateColumn("total_clicks", gorm.Expr("total_clicks + ?", perAd[adID])).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("Failed to save click batch: %v", err)
+		return nil, err
 	}
-	return nil
+
+	return inserted, nil
+}
+
+// insertedClick identifies a row an INSERT ... RETURNING actually wrote
+type insertedClick struct {
+	ID   string `gorm:"column:id"`
+	AdID string `gorm:"column:ad_id"`
 }
 
-func (r *AdsRepository) UpdateAdTotalClicks(adID string, increment int) error {
-	result := r.DB.Model(&model.Ad{}).
-		Where("id = ?", adID).
-		UpdateColumn("total_clicks", gorm.Expr("total_clicks + ?", increment))
+// claimClickIDs records the clicks' IDs in click_ids and returns the clicks
+// whose ID was not seen before, each ID at most once
+func claimClickIDs(tx *gorm.DB, clicks []model.Clicks) ([]model.Clicks, error) {
+	var sb strings.Builder
+	args := make([]interface{}, 0, len(clicks)*2)
 
-	if result.Error != nil {
-		return result.Error
+	sb.WriteString("INSERT INTO click_ids (id, timestamp) VALUES ")
+	for i, c := range clicks {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?)")
+		args = append(args, c.ID, c.Timestamp)
+	}
+	sb.WriteString(" ON CONFLICT (id) DO NOTHING RETURNING id")
+
+	var ids []string
+	if err := tx.Raw(sb.String(), args...).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+
+	fresh := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		fresh[strings.TrimRight(id, " ")] = true
+	}
+
+	claimed := make([]model.Clicks, 0, len(ids))
+	for _, c := range clicks {
+		if fresh[c.ID] {
+			claimed = append(claimed, c)
+			delete(fresh, c.ID)
+		}
+	}
+	return claimed, nil
+}
+
+// insertClicksIgnoringDuplicates inserts clicks and returns every row that
+// was actually written
+func insertClicksIgnoringDuplicates(tx *gorm.DB, clicks []model.Clicks) ([]insertedClick, error) {
+	var sb strings.Builder
+	args := make([]interface{}, 0, len(clicks)*5)
+
+	sb.WriteString("INSERT INTO clicks (id, ad_id, ip, playback_time, timestamp) VALUES ")
+	for i, c := range clicks {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?, ?, ?, ?)")
+		args = append(args, c.ID, c.AdID, c.IP, c.VideoPlayTime, c.Timestamp)
 	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+	sb.WriteString(" ON CONFLICT (id, timestamp) DO NOTHING RETURNING id, ad_id")
+
+	var rows []insertedClick
+	if err := tx.Raw(sb.String(), args...).Scan(&rows).Error; err != nil {
+		return nil, err
 	}
-	return nil
+	return rows, nil
 }
 
-func (r *AdsRepository) GetAdsTotalClicks(adID string) (int, error) {
+func (r *AdsRepository) UpdateAdTotalClicks(ctx context.Context, adID string, increment int) error {
+	return r.guardWrite(ctx, func(ctx context.Context) error {
+		result := r.DB.WithContext(ctx).Model(&model.Ad{}).
+			Where("id = ?", adID).
+			UpdateColumn("total_clicks", gorm.Expr("total_clicks + ?", increment))
+
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *AdsRepository) GetAdsTotalClicks(ctx context.Context, adID string) (int, error) {
 	var ad model.Ad
-	if err := r.DB.Select("total_clicks").Where("id = ?", adID).First(&ad).Error; err != nil {
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Select("total_clicks").Where("id = ?", adID).First(&ad).Error
+	})
+	if err != nil {
 		return 0, err
 	}
 	return ad.TotalClicks, nil
 }
 
-func (r *AdsRepository) GetClickCountByTimeFrame(adID string, start, end time.Time) (int, error) {
+func (r *AdsRepository) GetClickCountByTimeFrame(ctx context.Context, adID string, start, end time.Time) (int, error) {
 	var count int64
-	err := r.DB.Model(&model.Clicks{}).
-		Where("ad_id = ? AND timestamp BETWEEN ? AND ?", adID, start, end).
-		Count(&count).Error
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Model(&model.Clicks{}).
+			Where("ad_id = ? AND timestamp BETWEEN ? AND ?", adID, start, end).
+			Count(&count).Error
+	})
 	return int(count), err
 }
 
-func (r *AdsRepository) AdsExists(adID string) (bool, error) {
+func (r *AdsRepository) AdsExists(ctx context.Context, adID string) (bool, error) {
 	var count int64
-	err := r.DB.Model(&model.Ad{}).Where("id = ?", adID).Count(&count).Error
+	err := r.guardWrite(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Model(&model.Ad{}).Where("id = ?", adID).Count(&count).Error
+	})
 	return count > 0, err
 }
 
-func (r *AdsRepository) GetClickCountByIP(adID string, ip string) (int, error) {
+func (r *AdsRepository) GetClickCountByIP(ctx context.Context, adID string, ip string) (int, error) {
 	var count int64
-	err := r.DB.Model(&model.Clicks{}).
-		Where("ad_id = ? AND ip = ?", adID, ip).
-		Count(&count).Error
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Model(&model.Clicks{}).
+			Where("ad_id = ? AND ip = ?", adID, ip).
+			Count(&count).Error
+	})
 	return int(count), err
 }
 
 // SaveClick saves a single click event
-func (r *AdsRepository) SaveClick(click *model.Clicks) error {
-	return r.DB.Create(click).Error
+func (r *AdsRepository) SaveClick(ctx context.Context, click *model.Clicks) error {
+	return r.guardWrite(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Create(click).Error
+	})
 }
 
 // GetRecentClicks gets recent clicks for analytics
-func (r *AdsRepository) GetRecentClicks(adID string, minutes int) ([]model.Clicks, error) {
+func (r *AdsRepository) GetRecentClicks(ctx context.Context, adID string, minutes int) ([]model.Clicks, error) {
 	var clicks []model.Clicks
 	since := time.Now().Add(-time.Duration(minutes) * time.Minute)
-	err := r.DB.Where("ad_id = ? AND timestamp > ?", adID, since).Find(&clicks).Error
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Where("ad_id = ? AND timestamp > ?", adID, since).Find(&clicks).Error
+	})
+	return clicks, err
+}
+
+// ClickCountComparison pairs an ad's denormalised total_clicks counter with
+// the number of click rows actually stored for it
+type ClickCountComparison struct {
+	AdID    string `gorm:"column:ad_id"`
+	Counter int64  `gorm:"column:counter"`
+	Actual  int64  `gorm:"column:actual"`
+}
+
+// CompareClickTotals recomputes per-ad click totals from the clicks table
+func (r *AdsRepository) CompareClickTotals(ctx context.Context) ([]ClickCountComparison, error) {
+	var rows []ClickCountComparison
+	err := r.guardScan(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Raw(`SELECT a.id AS ad_id, a.total_clicks AS counter, COALESCE(c.cnt, 0) AS actual
+			FROM ads a
+			LEFT JOIN (SELECT ad_id, COUNT(*) AS cnt FROM clicks GROUP BY ad_id) c ON c.ad_id = a.id
+			WHERE a.deleted_at IS NULL
+			ORDER BY a.id`).
+			Scan(&rows).Error
+	})
+	return rows, err
+}
+
+// SetAdTotalClicks overwrites an ad's counter, but only if it still holds the
+// expected value so concurrent increments are never clobbered
+func (r *AdsRepository) SetAdTotalClicks(ctx context.Context, adID string, expected, total int64) (bool, error) {
+	var fixed bool
+	err := r.guardWrite(ctx, func(ctx context.Context) error {
+		result := r.DB.WithContext(ctx).Model(&model.Ad{}).
+			Where("id = ? AND total_clicks = ?", adID, expected).
+			UpdateColumn("total_clicks", total)
+		fixed = result.RowsAffected > 0
+		return result.Error
+	})
+	return fixed, err
+}
+
+// QuarantineClicks parks clicks that can never be written to the clicks table,
+// recording why. Clicks already quarantined, under any timestamp, are left as
+// they are.
+func (r *AdsRepository) QuarantineClicks(ctx context.Context, clicks []model.Clicks, reason string) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	args := make([]interface{}, 0, len(clicks)*6)
+
+	sb.WriteString("INSERT INTO clicks_quarantine (id, ad_id, ip, playback_time, timestamp, error) VALUES ")
+	for i, c := range clicks {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?, ?, ?, ?, ?)")
+		args = append(args, c.ID, c.AdID, c.IP, c.VideoPlayTime, c.Timestamp, reason)
+	}
+	sb.WriteString(" ON CONFLICT (id) DO NOTHING")
+
+	return r.guardBatch(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Exec(sb.String(), args...).Error
+	})
+}
+
+// QuarantinedClick is a click parked in clicks_quarantine
+type QuarantinedClick struct {
+	model.Clicks
+	Error         string    `gorm:"column:error" json:"error"`
+	QuarantinedAt time.Time `gorm:"column:quarantined_at" json:"quarantined_at"`
+}
+
+// GetQuarantinedClicks returns up to limit quarantined clicks, oldest first,
+// optionally only those of adID
+func (r *AdsRepository) GetQuarantinedClicks(ctx context.Context, adID string, limit int) ([]QuarantinedClick, error) {
+	var clicks []QuarantinedClick
+	err := r.guardRead(ctx, func(ctx context.Context) error {
+		query := r.DB.WithContext(ctx).Table("clicks_quarantine").
+			Select("id, ad_id, ip, playback_time, timestamp, error, quarantined_at").
+			Order("quarantined_at, id").
+			Limit(limit)
+		if adID != "" {
+			query = query.Where("ad_id = ?", adID)
+		}
+		return query.Scan(&clicks).Error
+	})
 	return clicks, err
 }
+
+// ReleaseQuarantinedClicks removes clicks from the quarantine, once they have
+// been replayed
+func (r *AdsRepository) ReleaseQuarantinedClicks(ctx context.Context, clicks []model.Clicks) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	args := make([]interface{}, 0, len(clicks))
+
+	sb.WriteString("DELETE FROM clicks_quarantine WHERE id IN (")
+	for i, c := range clicks {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("?")
+		args = append(args, c.ID)
+	}
+	sb.WriteString(")")
+
+	return r.guardBatch(ctx, func(ctx context.Context) error {
+		return r.DB.WithContext(ctx).Exec(sb.String(), args...).Error
+	})
+}
+
+// EachClick streams the clicks in [start, end), optionally only those of
+// adID, in timestamp order without loading them all into memory
+func (r *AdsRepository) EachClick(ctx context.Context, adID string, start, end time.Time, fn func(model.Clicks) error) error {
+	db := r.DB.WithContext(ctx)
+	query := db.Model(&model.Clicks{}).
+		Where("timestamp >= ? AND timestamp < ?", start, end).
+		Order("timestamp, id")
+	if adID != "" {
+		query = query.Where("ad_id = ?", adID)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var click model.Clicks
+		if err := db.ScanRows(rows, &click); err != nil {
+			return err
+		}
+		if err := fn(click); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/bulkhead"
+	"gorm.io/gorm"
+)
+
+// IsNotFound reports whether a lookup found no row
+func IsNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// IsTransientError reports whether a failed write is worth retrying as is.
+// Connection problems, timeouts, lock conflicts, resource exhaustion, server
+// restarts and a shed load (open breaker, full bulkhead) are transient; data
+// and constraint errors (e.g. a foreign key violation for a deleted ad) and
+// anything not recognised will fail the same way every time.
+func IsTransientError(err error) bool {
+	if err == nil || IsNotFound(err) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return isTransientSQLState(pgErr.Code)
+	}
+
+	// Shed by our own guards before reaching Postgres
+	if errors.Is(err, breaker.ErrCircuitBreakerOpen) || errors.Is(err, bulkhead.ErrBulkheadFull) {
+		return true
+	}
+
+	// The statement never got a verdict from the server
+	if pgconn.Timeout(err) || pgconn.SafeToRetry(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isTransientSQLState classifies a Postgres SQLSTATE code
+func isTransientSQLState(code string) bool {
+	switch {
+	case strings.HasPrefix(code, "08"): // connection exception
+		return true
+	case strings.HasPrefix(code, "40"): // serialization failure, deadlock
+		return true
+	case strings.HasPrefix(code, "53"): // insufficient resources
+		return true
+	case strings.HasPrefix(code, "57"): // operator intervention (shutdown, cancel)
+		return true
+	case code == "55P03": // lock not available
+		return true
+	case strings.HasPrefix(code, "58"): // system error (I/O)
+		return true
+	default:
+		// 22 data exception, 23 integrity constraint violation, 42 syntax or
+		// access rule violation and everything else won't fix itself
+		return false
+	}
+}
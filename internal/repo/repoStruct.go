@@ -1,26 +1,121 @@
 package repo
 
 import (
+	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/bulkhead"
 	"gorm.io/gorm"
 )
 
 type AdsRepoInt interface {
-	FetchAdsAll() ([]model.Ad, error)
-	CountAds() (int, error)
-	SaveBatchAds(clicks []model.Clicks) error
-	UpdateAdTotalClicks(adID string, increment int) error
-	GetAdsTotalClicks(adID string) (int, error)
-	GetClickCountByTimeFrame(adID string, start, end time.Time) (int, error)
-	AdsExists(adID string) (bool, error)
-	GetClickCountByIP(adID string, ip string) (int, error)
+	FetchAdsAll(ctx context.Context) ([]model.Ad, error)
+	CountAds(ctx context.Context) (int, error)
+	SaveBatchAds(ctx context.Context, clicks []model.Clicks) ([]string, error)
+	CopyBatchAds(ctx context.Context, clicks []model.Clicks) ([]string, error)
+	UpdateAdTotalClicks(ctx context.Context, adID string, increment int) error
+	GetAdsTotalClicks(ctx context.Context, adID string) (int, error)
+	GetClickCountByTimeFrame(ctx context.Context, adID string, start, end time.Time) (int, error)
+	AdsExists(ctx context.Context, adID string) (bool, error)
+	GetClickCountByIP(ctx context.Context, adID string, ip string) (int, error)
+	CompareClickTotals(ctx context.Context) ([]ClickCountComparison, error)
+	SetAdTotalClicks(ctx context.Context, adID string, expected, total int64) (bool, error)
+	QuarantineClicks(ctx context.Context, clicks []model.Clicks, reason string) error
+	GetQuarantinedClicks(ctx context.Context, adID string, limit int) ([]QuarantinedClick, error)
+	ReleaseQuarantinedClicks(ctx context.Context, clicks []model.Clicks) error
+	EachClick(ctx context.Context, adID string, start, end time.Time, fn func(model.Clicks) error) error
+	UpsertAds(ctx context.Context, ads []model.Ad) error
+	CreateAPIKey(ctx context.Context, key *model.APIKey) error
+	RevokeAPIKeys(ctx context.Context, idOrPrefix string) (int, error)
+	IsActiveAPIKey(ctx context.Context, keyHash string) (bool, error)
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
 }
 type AdsRepository struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	guards Guards
 }
 
-func NewAdsRepository(db *gorm.DB) *AdsRepository {
-	return &AdsRepository{DB: db}
+// Guards bound the queries the repository runs. Ingestion (click writes and
+// the checks on their path) and analytics reads share the connection pool but
+// never more than their own bulkhead's share of it. Zero values leave the
+// matching protection off, as the CLI tools do.
+type Guards struct {
+	Breaker *breaker.CircuitBreaker
+	Writes  *bulkhead.Bulkhead
+	Reads   *bulkhead.Bulkhead
+
+	// QueryTimeout bounds single queries, BatchTimeout click batch writes
+	QueryTimeout time.Duration
+	BatchTimeout time.Duration
+}
+
+// NewAdsRepository creates a repository whose queries go through guards
+func NewAdsRepository(db *gorm.DB, guards Guards) *AdsRepository {
+	return &AdsRepository{DB: db, guards: guards}
+}
+
+// Available reports whether the Postgres breaker lets calls through: closed,
+// or half-open and waiting for a probe call to decide
+func (r *AdsRepository) Available() bool {
+	return r.guards.Breaker == nil || r.guards.Breaker.State() != breaker.StateOpen
+}
+
+// guardWrite runs an ingestion query in the writes bulkhead
+func (r *AdsRepository) guardWrite(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.guard(ctx, r.guards.Writes, r.guards.QueryTimeout, fn)
+}
+
+// guardBatch runs a click batch write in the writes bulkhead
+func (r *AdsRepository) guardBatch(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.guard(ctx, r.guards.Writes, r.guards.BatchTimeout, fn)
+}
+
+// guardRead runs an analytics query in the reads bulkhead
+func (r *AdsRepository) guardRead(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.guard(ctx, r.guards.Reads, r.guards.QueryTimeout, fn)
+}
+
+// guardScan runs a whole-table analytics query in the reads bulkhead, with
+// the batch deadline since it reads far more rows than a single query
+func (r *AdsRepository) guardScan(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.guard(ctx, r.guards.Reads, r.guards.BatchTimeout, fn)
+}
+
+// guard takes a bulkhead slot and then runs fn through the Postgres circuit
+// breaker with the operation's timeout. The slot is taken first so time spent
+// queueing never counts as a slow call or eats into the timeout.
+//
+// The breaker returns as soon as ctx is done, while the query may still be
+// running on its connection, so the slot is only given back once fn returns.
+func (r *AdsRepository) guard(ctx context.Context, slots *bulkhead.Bulkhead, timeout time.Duration, fn func(ctx context.Context) error) error {
+	release := func() {}
+	if slots != nil {
+		var err error
+		if release, err = slots.Acquire(ctx); err != nil {
+			return err
+		}
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Whichever claims the slot first gives it back: fn when it returns, or
+	// guard itself when the breaker never ran fn
+	var claimed atomic.Bool
+	err := r.guards.Breaker.CallContext(ctx, func(ctx context.Context) error {
+		if claimed.CompareAndSwap(false, true) {
+			defer release()
+		}
+		return fn(ctx)
+	})
+	if claimed.CompareAndSwap(false, true) {
+		release()
+	}
+	return err
 }
@@ -6,17 +6,33 @@ import (
 	"math/rand"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
 	"gorm.io/gorm"
 )
 
 type Seeder struct {
-	db *gorm.DB
+	db  *gorm.DB
+	rng *rand.Rand // every generated value comes from here, so a seed reproduces the data
+
+	// AdLimit caps how many catalog ads SeedAll creates (0 seeds all of them)
+	AdLimit int
+
+	// HistoryDays is how many days of sample clicks SeedAll generates per ad
+	HistoryDays int
+
+	// Until is where the click history ends; the start of the current UTC
+	// day by default. Fix it too to reproduce a data set exactly.
+	Until time.Time
 }
 
-func NewSeeder(db *gorm.DB) *Seeder {
-	return &Seeder{db: db}
+// NewSeeder creates a seeder whose generated data is determined by seed
+func NewSeeder(db *gorm.DB, seed int64) *Seeder {
+	return &Seeder{
+		db:          db,
+		rng:         rand.New(rand.NewSource(seed)),
+		HistoryDays: 30,
+		Until:       time.Now().UTC().Truncate(24 * time.Hour),
+	}
 }
 
 func (s *Seeder) SeedAll() error {
@@ -210,6 +226,10 @@ func (s *Seeder) seedAds() error {
 		},
 	}
 
+	if s.AdLimit > 0 && s.AdLimit < len(ads) {
+		ads = ads[:s.AdLimit]
+	}
+
 	// Insert ads in batches
 	batchSize := 10
 	for i := 0; i < len(ads); i += batchSize {
@@ -231,7 +251,7 @@ func (s *Seeder) seedAds() error {
 func (s *Seeder) seedSampleClicks() error {
 	// Get all ads
 	var ads []model.Ad
-	if err := s.db.Find(&ads).Error; err != nil {
+	if err := s.db.Order("id").Find(&ads).Error; err != nil {
 		return fmt.Errorf("failed to fetch ads: %w", err)
 	}
 
@@ -239,16 +259,15 @@ func (s *Seeder) seedSampleClicks() error {
 		return fmt.Errorf("no ads found to seed clicks for")
 	}
 
-	// Generate sample clicks for the last 30 days
-	now := time.Now()
-	startDate := now.AddDate(0, 0, -30) // 30 days ago
+	// Generate sample clicks for the HistoryDays days before Until
+	endDate := s.Until
+	startDate := endDate.AddDate(0, 0, -s.HistoryDays)
 
 	var allClicks []model.Clicks
-	rand.Seed(time.Now().UnixNano())
 
 	// Generate different patterns for different ads
 	for _, ad := range ads {
-		clicks := s.generateClicksForAd(ad.ID, startDate, now)
+		clicks := s.generateClicksForAd(ad.ID, startDate, endDate)
 		allClicks = append(allClicks, clicks...)
 	}
 
@@ -286,42 +305,27 @@ func (s *Seeder) generateClicksForAd(adID string, startDate, endDate time.Time)
 	var clicks []model.Clicks
 
 	// Different click patterns based on ad category
-	var dailyRange, hourlyVariance int
-	switch {
-	case adID[:4] == "tech":
-		dailyRange = 50 + rand.Intn(100) // 50-150 clicks per day
-		hourlyVariance = 20
-	case adID[:7] == "fashion":
-		dailyRange = 30 + rand.Intn(80) // 30-110 clicks per day
-		hourlyVariance = 15
-	case adID[:4] == "food":
-		dailyRange = 80 + rand.Intn(120) // 80-200 clicks per day
-		hourlyVariance = 30
-	case adID[:6] == "travel":
-		dailyRange = 20 + rand.Intn(60) // 20-80 clicks per day
-		hourlyVariance = 10
-	default:
-		dailyRange = 40 + rand.Intn(80) // 40-120 clicks per day
-		hourlyVariance = 25
-	}
+	volume := volumeFor(adID)
+	dailyRange := volume.base + s.rng.Intn(volume.spread)
+	hourlyVariance := volume.variance
 
 	// Generate clicks for each day
 	for d := startDate; d.Before(endDate); d = d.AddDate(0, 0, 1) {
-		dailyClicks := dailyRange + rand.Intn(hourlyVariance) - hourlyVariance/2
+		dailyClicks := dailyRange + s.rng.Intn(hourlyVariance) - hourlyVariance/2
 
 		// Distribute clicks throughout the day with peak hours
 		for i := 0; i < dailyClicks; i++ {
-			hour := s.getRandomHourWithPeaks()
-			minute := rand.Intn(60)
-			second := rand.Intn(60)
+			hour := randomHour(s.rng)
+			minute := s.rng.Intn(60)
+			second := s.rng.Intn(60)
 
 			clickTime := time.Date(d.Year(), d.Month(), d.Day(), hour, minute, second, 0, time.UTC)
 
 			click := model.Clicks{
-				ID:            uuid.New().String(),
+				ID:            randomUUID(s.rng),
 				AdID:          adID,
-				IP:            s.generateRandomIP(),
-				VideoPlayTime: rand.Intn(300) + 5, // 5-305 seconds
+				IP:            randomIP(s.rng),
+				VideoPlayTime: randomPlaybackTime(s.rng),
 				Timestamp:     clickTime,
 			}
 
@@ -332,34 +336,6 @@ func (s *Seeder) generateClicksForAd(adID string, startDate, endDate time.Time)
 	return clicks
 }
 
-func (s *Seeder) getRandomHourWithPeaks() int {
-	// Peak hours: 9-11 AM, 2-4 PM, 7-9 PM
-	peakHours := []int{9, 10, 11, 14, 15, 16, 19, 20, 21}
-
-	if rand.Float32() < 0.6 { // 60% chance for peak hours
-		return peakHours[rand.Intn(len(peakHours))]
-	}
-
-	// Return any hour for off-peak
-	return rand.Intn(24)
-}
-
-func (s *Seeder) generateRandomIP() string {
-	// Generate realistic IP addresses (avoiding private ranges mostly)
-	ranges := []string{
-		"203.%d.%d.%d", // Asia-Pacific
-		"185.%d.%d.%d", // Europe
-		"104.%d.%d.%d", // North America
-		"190.%d.%d.%d", // South America
-	}
-
-	pattern := ranges[rand.Intn(len(ranges))]
-	return fmt.Sprintf(pattern,
-		rand.Intn(256),
-		rand.Intn(256),
-		rand.Intn(256))
-}
-
 // SeedTestData creates minimal test data for development
 func (s *Seeder) SeedTestData() error {
 	// Check if test data already exists
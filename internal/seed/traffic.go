@@ -0,0 +1,189 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+)
+
+// categoryVolume is an ad category's daily click volume: base plus up to
+// spread clicks a day, varying by up to variance from one day to the next
+type categoryVolume struct {
+	prefix                 string
+	base, spread, variance int
+}
+
+var categoryVolumes = []categoryVolume{
+	{prefix: "tech", base: 50, spread: 100, variance: 20},   // 50-150 clicks per day
+	{prefix: "fashion", base: 30, spread: 80, variance: 15}, // 30-110 clicks per day
+	{prefix: "food", base: 80, spread: 120, variance: 30},   // 80-200 clicks per day
+	{prefix: "travel", base: 20, spread: 60, variance: 10},  // 20-80 clicks per day
+}
+
+var defaultVolume = categoryVolume{base: 40, spread: 80, variance: 25} // 40-120 clicks per day
+
+func volumeFor(adID string) categoryVolume {
+	for _, v := range categoryVolumes {
+		if strings.HasPrefix(adID, v.prefix) {
+			return v
+		}
+	}
+	return defaultVolume
+}
+
+// Peak hours: 9-11 AM, 2-4 PM, 7-9 PM get peakShare of the clicks, the rest
+// is spread over the whole day
+var peakHours = []int{9, 10, 11, 14, 15, 16, 19, 20, 21}
+
+const peakShare = 0.6
+
+func randomHour(rng *rand.Rand) int {
+	if rng.Float32() < peakShare {
+		return peakHours[rng.Intn(len(peakHours))]
+	}
+	return rng.Intn(24)
+}
+
+// HourWeight is hour's click volume relative to the daily average (1.0)
+func HourWeight(hour int) float64 {
+	weight := 1 - peakShare // off-peak share, spread over 24 hours
+	for _, h := range peakHours {
+		if h == hour {
+			weight += peakShare * 24 / float64(len(peakHours))
+			break
+		}
+	}
+	return weight
+}
+
+func randomIP(rng *rand.Rand) string {
+	// Generate realistic IP addresses (avoiding private ranges mostly)
+	ranges := []string{
+		"203.%d.%d.%d", // Asia-Pacific
+		"185.%d.%d.%d", // Europe
+		"104.%d.%d.%d", // North America
+		"190.%d.%d.%d", // South America
+	}
+
+	pattern := ranges[rng.Intn(len(ranges))]
+	return fmt.Sprintf(pattern, rng.Intn(256), rng.Intn(256), rng.Intn(256))
+}
+
+func randomPlaybackTime(rng *rand.Rand) int {
+	return rng.Intn(300) + 5 // 5-305 seconds
+}
+
+func randomUUID(rng *rand.Rand) string {
+	id, err := uuid.NewRandomFromReader(rng)
+	if err != nil {
+		panic(err) // math/rand never fails to read
+	}
+	return id.String()
+}
+
+// Kinds of generated clicks
+type ClickKind int
+
+const (
+	ClickOrganic   ClickKind = iota
+	ClickDuplicate           // an exact resend of an earlier click
+	ClickBot                 // from a small pool of IPs, barely watched
+)
+
+func (k ClickKind) String() string {
+	switch k {
+	case ClickDuplicate:
+		return "duplicate"
+	case ClickBot:
+		return "bot"
+	default:
+		return "organic"
+	}
+}
+
+// botIPs is the pool bot clicks come from (TEST-NET-2, never routed)
+var botIPs = []string{
+	"198.51.100.7", "198.51.100.23", "198.51.100.42", "198.51.100.99",
+	"198.51.100.128", "198.51.100.150", "198.51.100.201", "198.51.100.254",
+}
+
+// recentClicks is how many organic clicks duplicates are drawn from
+const recentClicks = 256
+
+// Traffic generates live clicks with the same shape as the sample data: ads
+// are picked in proportion to their category's daily volume and clicks come
+// from realistic client IPs. A share of them are duplicates or bots. Traffic
+// is not safe for concurrent use.
+type Traffic struct {
+	rng        *rand.Rand
+	ads        []string
+	cumWeights []float64
+
+	duplicateRate float64
+	botRate       float64
+	recent        []model.Clicks
+	next          int
+}
+
+// NewTraffic creates a generator over adIDs whose choices are determined by seed
+func NewTraffic(adIDs []string, duplicateRate, botRate float64, seed int64) *Traffic {
+	t := &Traffic{
+		rng:           rand.New(rand.NewSource(seed)),
+		ads:           adIDs,
+		cumWeights:    make([]float64, len(adIDs)),
+		duplicateRate: duplicateRate,
+		botRate:       botRate,
+	}
+
+	var total float64
+	for i, id := range adIDs {
+		v := volumeFor(id)
+		total += float64(v.base) + float64(v.spread)/2
+		t.cumWeights[i] = total
+	}
+	return t
+}
+
+// Next returns the click to send at now and what kind of click it is
+func (t *Traffic) Next(now time.Time) (model.Clicks, ClickKind) {
+	r := t.rng.Float64()
+	if r < t.duplicateRate && len(t.recent) > 0 {
+		return t.recent[t.rng.Intn(len(t.recent))], ClickDuplicate
+	}
+
+	click := model.Clicks{
+		ID:        randomUUID(t.rng),
+		AdID:      t.ad(),
+		Timestamp: now,
+	}
+	if r < t.duplicateRate+t.botRate {
+		click.IP = botIPs[t.rng.Intn(len(botIPs))]
+		click.VideoPlayTime = t.rng.Intn(3) // bots don't watch
+		return click, ClickBot
+	}
+
+	click.IP = randomIP(t.rng)
+	click.VideoPlayTime = randomPlaybackTime(t.rng)
+	if len(t.recent) < recentClicks {
+		t.recent = append(t.recent, click)
+	} else {
+		t.recent[t.next] = click
+		t.next = (t.next + 1) % recentClicks
+	}
+	return click, ClickOrganic
+}
+
+// ad picks an ad in proportion to its category's volume
+func (t *Traffic) ad() string {
+	r := t.rng.Float64() * t.cumWeights[len(t.cumWeights)-1]
+	for i, w := range t.cumWeights {
+		if r < w {
+			return t.ads[i]
+		}
+	}
+	return t.ads[len(t.ads)-1]
+}
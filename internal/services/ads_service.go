@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,55 +12,99 @@ import (
 	"github.com/google/uuid"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
-	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
 )
 
-func NewAdsService(adsRepo *repo.AdsRepository, log *logger.Logger, nats *NATSService, cb *breaker.CircuitBreaker) *AdsService {
-	return &AdsService{
-		adsRepo:      adsRepo,
-		log:          log,
-		nats:         nats,
-		cb:           cb,
-		counters:     make(map[string]*CounterEntry),
-		currentBatch: make([]model.Clicks, 0),
-		processedIDs: sync.Map{},
+// ErrAdNotFound is returned when a click or analytics request names an unknown ad
+var ErrAdNotFound = errors.New("ad not found")
+
+// ErrClickNotPublished is returned when NATS won't take a click and this node
+// may not write it itself
+var ErrClickNotPublished = errors.New("click not published to NATS")
+
+// NewAdsService creates the ads service. With localFallback set, clicks that
+// can't be published to NATS are processed and written by this node instead.
+func NewAdsService(adsRepo *repo.AdsRepository, writer repo.ClickWriter, batchCfg BatchConfig, spool *ClickSpool, cache *AnalyticsCache, log *logger.Logger, nats *NATSService, localFallback bool) *AdsService {
+	s := &AdsService{
+		adsRepo:       adsRepo,
+		writer:        writer,
+		spool:         spool,
+		cache:         cache,
+		log:           log,
+		nats:          nats,
+		localFallback: localFallback,
+		counters:      make(map[string]*CounterEntry),
+		processedIDs:  sync.Map{},
 	}
+	s.batcher = newClickBatcher(batchCfg, batchTarget{
+		write:      s.writeBatch,
+		quarantine: adsRepo.QuarantineClicks,
+		spool:      spool,
+		available:  adsRepo.Available,
+	}, log)
+	return s
 }
 
-func (s *AdsService) GetAdsAllAds() ([]model.Ad, error) {
+func (s *AdsService) GetAdsAllAds(ctx context.Context) ([]model.Ad, error) {
 	start := time.Now()
 
-	ads, err := s.adsRepo.FetchAdsAll()
+	ads, err := s.adsRepo.FetchAdsAll(ctx)
 	if err != nil {
 		metrics.RecordError("fetch_ads_error", "ads_service")
-		s.log.Logger.Errorf("Failed to fetch ads: %v", err)
+		logger.FromContext(ctx, s.log).Logger.Errorf("Failed to fetch ads: %v", err)
 		return nil, fmt.Errorf("failed to fetch ads: %w", err)
 	}
 
 	metrics.RecordDatabaseOperation("select", "success", time.Since(start).Seconds())
+	if err := s.cache.StoreAds(ctx, ads); err != nil {
+		logger.FromContext(ctx, s.log).Logger.Warnf("Failed to cache ads: %v", err)
+	}
 	return ads, nil
 }
 
-func (s *AdsService) ProcessClick(click model.Clicks) error {
+// GetAdsAllAdsCached is GetAdsAllAds falling back to the cached ad list when
+// the database can't be reached; stale reports whether the cache was used
+func (s *AdsService) GetAdsAllAdsCached(ctx context.Context) (ads []model.Ad, stale bool, err error) {
+	ads, err = s.GetAdsAllAds(ctx)
+	if err == nil || ctx.Err() != nil {
+		return ads, false, err
+	}
+
+	cached, cacheErr := s.cache.LoadAds(ctx)
+	if cacheErr != nil || cached == nil {
+		return nil, false, err
+	}
+
+	logger.FromContext(ctx, s.log).Logger.Warnf("Serving cached ads list: %v", err)
+	metrics.RecordStaleAnalytics()
+	return cached, true, nil
+}
+
+func (s *AdsService) ProcessClick(ctx context.Context, click model.Clicks) error {
 	start := time.Now()
 
-	// Validate ad exists
-	exists, err := s.AdsExists(click.AdID)
-	if err != nil {
+	// Validate ad exists. If Postgres can't answer (breaker open, bulkhead
+	// full, connection lost) the click is queued or spooled anyway rather
+	// than dropped; a click on a deleted ad then fails the batch's foreign
+	// key and is quarantined.
+	exists, err := s.AdsExists(ctx, click.AdID)
+	switch {
+	case err != nil && repo.IsTransientError(err):
+		metrics.RecordError("ads_exists_check_skipped", "ads_service")
+		logger.FromContext(ctx, s.log).Logger.Debugf("Skipping existence check for ad %s: %v", click.AdID, err)
+	case err != nil:
 		metrics.RecordError("ads_exists_check_error", "ads_service")
 		return fmt.Errorf("failed to check if ad exists: %w", err)
-	}
-	if !exists {
+	case !exists:
 		metrics.RecordError("ad_not_found", "ads_service")
-		return fmt.Errorf("ad not found: %s", click.AdID)
+		return fmt.Errorf("%w: %s", ErrAdNotFound, click.AdID)
 	}
 
 	// Check for duplicate processing
 	clickKey := fmt.Sprintf("%s-%s-%d", click.AdID, click.IP, click.Timestamp.Unix())
 	if _, exists := s.processedIDs.LoadOrStore(clickKey, true); exists {
-		s.log.Logger.Warnf("Duplicate click detected: %s", clickKey)
+		logger.FromContext(ctx, s.log).Logger.Warnf("Duplicate click detected: %s", clickKey)
 		return nil
 	}
 
@@ -69,70 +115,74 @@ func (s *AdsService) ProcessClick(click model.Clicks) error {
 
 	// Record click
 	if err := s.RecordClick(click); err != nil {
+		// Forget the click so a redelivery isn't mistaken for a duplicate
+		s.processedIDs.Delete(clickKey)
 		metrics.RecordError("record_click_error", "ads_service")
 		return fmt.Errorf("failed to record click: %w", err)
 	}
 
-	// Update counter
+	// Update counter; ads.total_clicks is bumped when the batch is persisted
 	s.UpdateCounter(click)
 
-	// Update ad total clicks
-	if err := s.adsRepo.UpdateAdTotalClicks(click.AdID, 1); err != nil {
-		s.log.Logger.Errorf("Failed to update ad total clicks: %v", err)
-	}
-
 	metrics.RecordClick(click.AdID, time.Since(start).Seconds())
 	return nil
 }
 
+// RecordClick queues a click for the batch writer. It never waits on the
+// database; if the writer has fallen behind the click goes to the disk spool,
+// and ErrBatchQueueFull is only returned when there is no spool to take it.
 func (s *AdsService) RecordClick(click model.Clicks) error {
-	// Use circuit breaker for database operations
-	return s.cb.Call(func() error {
-		s.batchMutex.Lock()
-		defer s.batchMutex.Unlock()
-
-		s.currentBatch = append(s.currentBatch, click)
-
-		// Process batch if it reaches threshold
-		if len(s.currentBatch) >= 100 {
-			return s.processBatchInternal()
-		}
-
-		return nil
-	})
-}
-
-func (s *AdsService) ProcessBatch() error {
-	s.batchMutex.Lock()
-	defer s.batchMutex.Unlock()
-
-	if len(s.currentBatch) == 0 {
-		return nil
+	err := s.batcher.enqueue(click)
+	if errors.Is(err, ErrBatchQueueFull) && s.spool != nil {
+		return s.spool.Append([]model.Clicks{click})
 	}
-
-	return s.processBatchInternal()
+	return err
 }
 
-func (s *AdsService) processBatchInternal() error {
-	if len(s.currentBatch) == 0 {
-		return nil
-	}
+// ProcessBatch writes all queued clicks now, waiting until ctx is done
+func (s *AdsService) ProcessBatch(ctx context.Context) error {
+	return s.batcher.flush(ctx)
+}
 
+// writeBatch persists one batch. It is only called from the batch writer
+// goroutine; the repository's Postgres breaker guards the write.
+func (s *AdsService) writeBatch(ctx context.Context, batch []model.Clicks) error {
 	start := time.Now()
 
-	err := s.adsRepo.SaveBatchAds(s.currentBatch)
+	inserted, err := s.writer.WriteClicks(ctx, batch)
 	if err != nil {
-		metrics.RecordError("batch_save_error", "ads_service")
+		metrics.RecordDatabaseOperation("batch_"+s.writer.Name(), "error", time.Since(start).Seconds())
 		return fmt.Errorf("failed to save batch: %w", err)
 	}
 
-	s.log.Logger.Infof("Processed batch of %d clicks", len(s.currentBatch))
-	s.currentBatch = s.currentBatch[:0] // Clear the batch
-
-	metrics.RecordDatabaseOperation("batch_insert", "success", time.Since(start).Seconds())
+	s.log.Logger.Infof("Processed batch of %d clicks (%d new)", len(batch), len(inserted))
+	metrics.RecordDatabaseOperation("batch_"+s.writer.Name(), "success", time.Since(start).Seconds())
+	recordCommitLatency(batch, inserted, time.Now())
 	return nil
 }
 
+// recordCommitLatency records how long the clicks of a committed batch took
+// to get there. Only the inserted clicks count: a duplicate was committed by
+// an earlier delivery, and timing it again would report the redelivery.
+func recordCommitLatency(batch []model.Clicks, inserted []string, committedAt time.Time) {
+	written := make(map[string]struct{}, len(inserted))
+	for _, id := range inserted {
+		written[id] = struct{}{}
+	}
+
+	for _, click := range batch {
+		if _, ok := written[click.ID]; !ok {
+			continue
+		}
+		if !click.ConsumedAt.IsZero() {
+			metrics.RecordClickStageLatency(metrics.StageConsumeToCommit, committedAt.Sub(click.ConsumedAt))
+		}
+		if !click.IngestedAt.IsZero() {
+			metrics.RecordClickStageLatency(metrics.StageIngestToCommit, committedAt.Sub(click.IngestedAt))
+		}
+	}
+}
+
 func (s *AdsService) UpdateCounter(click model.Clicks) {
 	s.counterMutex.Lock()
 	defer s.counterMutex.Unlock()
@@ -150,7 +200,7 @@ func (s *AdsService) UpdateCounter(click model.Clicks) {
 	entry.LastUpdate = time.Now()
 }
 
-func (s *AdsService) GetClickCount(adID string) (int64, error) {
+func (s *AdsService) GetClickCount(ctx context.Context, adID string) (int64, error) {
 	s.counterMutex.RLock()
 	defer s.counterMutex.RUnlock()
 
@@ -159,12 +209,12 @@ func (s *AdsService) GetClickCount(adID string) (int64, error) {
 	}
 
 	// Fall back to database
-	count, err := s.adsRepo.GetAdsTotalClicks(adID)
+	count, err := s.adsRepo.GetAdsTotalClicks(ctx, adID)
 	return int64(count), err
 }
 
-func (s *AdsService) AdsExists(adID string) (bool, error) {
-	return s.adsRepo.AdsExists(adID)
+func (s *AdsService) AdsExists(ctx context.Context, adID string) (bool, error) {
+	return s.adsRepo.AdsExists(ctx, adID)
 }
 
 func (s *AdsService) ParseTimeFrame(timeFrame string) (time.Duration, error) {
@@ -198,7 +248,7 @@ func (s *AdsService) ParseTimeFrame(timeFrame string) (time.Duration, error) {
 	}
 }
 
-func (s *AdsService) GetClickCountByTimeFrame(adID string, timeFrame string) (int64, error) {
+func (s *AdsService) GetClickCountByTimeFrame(ctx context.Context, adID string, timeFrame string) (int64, error) {
 	duration, err := s.ParseTimeFrame(timeFrame)
 	if err != nil {
 		return 0, err
@@ -207,53 +257,96 @@ func (s *AdsService) GetClickCountByTimeFrame(adID string, timeFrame string) (in
 	end := time.Now()
 	start := end.Add(-duration)
 
-	count, err := s.adsRepo.GetClickCountByTimeFrame(adID, start, end)
+	count, err := s.adsRepo.GetClickCountByTimeFrame(ctx, adID, start, end)
 	return int64(count), err
 }
 
-func (s *AdsService) PublishClick(click model.Clicks) error {
+// PublishClick hands a click to NATS for the consumers. If NATS won't take
+// it, the click is processed here when local fallback is on and
+// ErrClickNotPublished is returned otherwise.
+func (s *AdsService) PublishClick(ctx context.Context, click model.Clicks) error {
+	log := logger.FromContext(ctx, s.log)
+
 	// If NATS is not available, process directly
 	if s.nats == nil {
-		s.log.Logger.Debug("NATS not available, processing click directly")
-		return s.ProcessClick(click)
+		if !s.localFallback {
+			metrics.RecordError("click_publish_dropped", "ads_service")
+			return fmt.Errorf("%w: not connected", ErrClickNotPublished)
+		}
+		log.Logger.Debug("NATS not available, processing click directly")
+		return s.ProcessClick(ctx, click)
 	}
 
 	// Publish to NATS
-	err := s.nats.PublishClick(click)
+	err := s.nats.PublishClick(ctx, click)
 	if err != nil {
 		metrics.RecordError("nats_publish_error", "ads_service")
+		if !s.localFallback {
+			metrics.RecordError("click_publish_dropped", "ads_service")
+			return fmt.Errorf("%w: %v", ErrClickNotPublished, err)
+		}
 		// Fallback to direct processing if NATS fails
-		s.log.Logger.Warnf("Failed to publish to NATS, processing directly: %v", err)
-		return s.ProcessClick(click)
+		log.Logger.Warnf("Failed to publish to NATS, processing directly: %v", err)
+		return s.ProcessClick(ctx, click)
 	}
 
-	s.log.Logger.Debugf("Click published to NATS for ad: %s", click.AdID)
+	log.Logger.Debugf("Click published to NATS for ad: %s", click.AdID)
 	return nil
 }
 
-// GetAnalytics returns comprehensive analytics for an ad
-func (s *AdsService) GetAnalytics(adID string) (*AnalyticsResponse, error) {
-	// Check if ad exists
-	exists, err := s.AdsExists(adID)
-	if err != nil {
+// GetAnalytics returns comprehensive analytics for an ad. If the database
+// can't be reached the last cached figures are returned, marked stale; a
+// request that ran out of time or was cancelled gets its context error.
+func (s *AdsService) GetAnalytics(ctx context.Context, adID string) (*AnalyticsResponse, error) {
+	analytics, err := s.loadAnalytics(ctx, adID)
+	if err == nil {
+		if err := s.cache.StoreAnalytics(ctx, analytics); err != nil {
+			logger.FromContext(ctx, s.log).Logger.Warnf("Failed to cache analytics for ad %s: %v", adID, err)
+		}
+		return analytics, nil
+	}
+	if errors.Is(err, ErrAdNotFound) || ctx.Err() != nil {
 		return nil, err
 	}
-	if !exists {
-		return nil, fmt.Errorf("ad not found: %s", adID)
+
+	cached, cacheErr := s.cache.LoadAnalytics(ctx, adID)
+	if cacheErr != nil || cached == nil {
+		return nil, err
 	}
 
-	// Get total clicks
-	totalClicks, err := s.adsRepo.GetAdsTotalClicks(adID)
+	logger.FromContext(ctx, s.log).Logger.Warnf("Serving cached analytics for ad %s: %v", adID, err)
+	metrics.RecordStaleAnalytics()
+	cached.Stale = true
+	return cached, nil
+}
+
+func (s *AdsService) loadAnalytics(ctx context.Context, adID string) (*AnalyticsResponse, error) {
+	// Get total clicks, which also checks the ad exists without touching the
+	// ingestion side of the connection pool
+	totalClicks, err := s.adsRepo.GetAdsTotalClicks(ctx, adID)
+	if repo.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", ErrAdNotFound, adID)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Get clicks for different time frames
-	last1m, _ := s.GetClickCountByTimeFrame(adID, "1m")
-	last5m, _ := s.GetClickCountByTimeFrame(adID, "5m")
-	last15m, _ := s.GetClickCountByTimeFrame(adID, "15m")
-	last1h, _ := s.GetClickCountByTimeFrame(adID, "1h")
-	last24h, _ := s.GetClickCountByTimeFrame(adID, "24h")
+	timeFrames := map[string]string{
+		"last_1_minute":   "1m",
+		"last_5_minutes":  "5m",
+		"last_15_minutes": "15m",
+		"last_1_hour":     "1h",
+		"last_24_hours":   "24h",
+	}
+	counts := make(map[string]int64, len(timeFrames))
+	for key, timeFrame := range timeFrames {
+		count, err := s.GetClickCountByTimeFrame(ctx, adID, timeFrame)
+		if err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
 
 	// Calculate CTR (assuming some impression data would be available)
 	// For now, we'll use a placeholder calculation
@@ -267,29 +360,38 @@ func (s *AdsService) GetAnalytics(adID string) (*AnalyticsResponse, error) {
 		AdID:        adID,
 		TotalClicks: int64(totalClicks),
 		CTR:         ctr,
-		TimeFrames: map[string]int64{
-			"last_1_minute":   last1m,
-			"last_5_minutes":  last5m,
-			"last_15_minutes": last15m,
-			"last_1_hour":     last1h,
-			"last_24_hours":   last24h,
-		},
-		Timestamp: time.Now(),
+		TimeFrames:  counts,
+		Timestamp:   time.Now(),
 	}, nil
 }
 
-// StartBatchProcessor starts a background goroutine to process batches periodically
+// StartBatchProcessor starts the background goroutine that writes queued clicks
 func (s *AdsService) StartBatchProcessor() {
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			if err := s.ProcessBatch(); err != nil {
-				s.log.Logger.Errorf("Failed to process batch: %v", err)
-			}
+	s.batcher.start()
+}
+
+// BatchBacklog returns how many clicks wait for the batch writer and how many
+// can wait before clicks are spooled or rejected
+func (s *AdsService) BatchBacklog() (queued, capacity int) {
+	return s.batcher.backlog()
+}
+
+// BatchWriterHeartbeat returns when the batch writer last went round its
+// loop; zero if it hasn't started
+func (s *AdsService) BatchWriterHeartbeat() time.Time {
+	return s.batcher.lastHeartbeat()
+}
+
+// StopBatchProcessor stops accepting clicks and writes whatever is still
+// queued, spooling what can't be written
+func (s *AdsService) StopBatchProcessor(ctx context.Context) error {
+	err := s.batcher.stop(ctx)
+	if s.spool != nil {
+		if closeErr := s.spool.Close(); closeErr != nil && err == nil {
+			err = closeErr
 		}
-	}()
+	}
+	return err
 }
 
 type AnalyticsResponse struct {
@@ -298,4 +400,8 @@ type AnalyticsResponse struct {
 	CTR         float64          `json:"ctr"`
 	TimeFrames  map[string]int64 `json:"time_frames"`
 	Timestamp   time.Time        `json:"timestamp"`
+
+	// Stale is set when the figures come from cache because the database
+	// could not be reached
+	Stale bool `json:"stale"`
 }
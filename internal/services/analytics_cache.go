@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+const (
+	analyticsCacheKeyPrefix = "analytics:"
+	adsCacheKey             = "ads:all"
+
+	// cacheTimeout keeps a slow Redis from holding up a request, on top of
+	// whatever deadline the request itself has
+	cacheTimeout = 200 * time.Millisecond
+)
+
+// AnalyticsCache keeps the last good analytics in Redis so reads can degrade
+// to slightly stale numbers while Postgres is unavailable. A nil cache or
+// Redis client turns every call into a no-op.
+type AnalyticsCache struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// NewAnalyticsCache creates a cache whose entries expire after ttl
+func NewAnalyticsCache(rdb *redis.Client, ttl time.Duration) *AnalyticsCache {
+	return &AnalyticsCache{rdb: rdb, ttl: ttl}
+}
+
+// StoreAnalytics saves an ad's analytics
+func (c *AnalyticsCache) StoreAnalytics(ctx context.Context, resp *AnalyticsResponse) error {
+	return c.store(ctx, analyticsCacheKeyPrefix+resp.AdID, resp)
+}
+
+// LoadAnalytics returns an ad's last stored analytics, or nil if there are none
+func (c *AnalyticsCache) LoadAnalytics(ctx context.Context, adID string) (*AnalyticsResponse, error) {
+	var resp AnalyticsResponse
+	found, err := c.load(ctx, analyticsCacheKeyPrefix+adID, &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StoreAds saves the ad list without its preloaded clicks
+func (c *AnalyticsCache) StoreAds(ctx context.Context, ads []model.Ad) error {
+	trimmed := make([]model.Ad, len(ads))
+	for i, ad := range ads {
+		ad.Clicks = nil
+		trimmed[i] = ad
+	}
+	return c.store(ctx, adsCacheKey, trimmed)
+}
+
+// LoadAds returns the last stored ad list, or nil if there is none
+func (c *AnalyticsCache) LoadAds(ctx context.Context) ([]model.Ad, error) {
+	var ads []model.Ad
+	if _, err := c.load(ctx, adsCacheKey, &ads); err != nil {
+		return nil, err
+	}
+	return ads, nil
+}
+
+func (c *AnalyticsCache) store(ctx context.Context, key string, value any) error {
+	if c == nil || c.rdb == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cacheTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err = c.rdb.Set(ctx, key, data, c.ttl).Err()
+	metrics.RecordRedisOperation("set", redisStatus(err), time.Since(start).Seconds())
+	return err
+}
+
+func (c *AnalyticsCache) load(ctx context.Context, key string, dest any) (bool, error) {
+	if c == nil || c.rdb == nil {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cacheTimeout)
+	defer cancel()
+
+	start := time.Now()
+	data, err := c.rdb.Get(ctx, key).Bytes()
+	metrics.RecordRedisOperation("get", redisStatus(err), time.Since(start).Seconds())
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, dest)
+}
+
+func redisStatus(err error) string {
+	switch err {
+	case nil:
+		return "success"
+	case redis.Nil:
+		return "miss"
+	default:
+		return "error"
+	}
+}
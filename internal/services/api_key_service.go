@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+)
+
+const (
+	apiKeyPrefix    = "amt_"
+	apiKeyBytes     = 32
+	apiKeyPrefixLen = 12 // characters of the key kept in clear to identify it
+
+	// How long a verified key is trusted before Postgres is asked again, and
+	// so how long a revocation can take to apply
+	apiKeyVerifyTTL = time.Minute
+)
+
+// APIKeyService issues, revokes and verifies API keys. Keys are shown once
+// when created; only their hash is stored.
+type APIKeyService struct {
+	repo *repo.AdsRepository
+
+	// When each key hash was last found active
+	mu       sync.Mutex
+	verified map[string]time.Time
+}
+
+// NewAPIKeyService creates a new APIKeyService
+func NewAPIKeyService(r *repo.AdsRepository) *APIKeyService {
+	return &APIKeyService{repo: r, verified: make(map[string]time.Time)}
+}
+
+// Create issues a key named name and returns it with its stored record
+func (s *APIKeyService) Create(ctx context.Context, name string) (string, *model.APIKey, error) {
+	if name == "" {
+		return "", nil, errors.New("api key name is required")
+	}
+
+	secret := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	record := &model.APIKey{
+		ID:      uuid.New().String(),
+		Name:    name,
+		Prefix:  key[:apiKeyPrefixLen],
+		KeyHash: HashAPIKey(key),
+	}
+	if err := s.repo.CreateAPIKey(ctx, record); err != nil {
+		return "", nil, fmt.Errorf("failed to store api key: %w", err)
+	}
+	return key, record, nil
+}
+
+// Revoke revokes the active keys matching an ID or prefix
+func (s *APIKeyService) Revoke(ctx context.Context, idOrPrefix string) (int, error) {
+	if idOrPrefix == "" {
+		return 0, errors.New("api key id or prefix is required")
+	}
+	return s.repo.RevokeAPIKeys(ctx, idOrPrefix)
+}
+
+// List returns every issued key
+func (s *APIKeyService) List(ctx context.Context) ([]model.APIKey, error) {
+	return s.repo.ListAPIKeys(ctx)
+}
+
+// Verify reports whether key is an issued key that hasn't been revoked. Keys
+// found active are trusted for a minute without asking Postgres again, and for
+// as long as Postgres can't answer: an outage is when the admin endpoints are
+// needed most, and revocations can't be checked then anyway.
+func (s *APIKeyService) Verify(ctx context.Context, key string) (bool, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return false, nil
+	}
+	hash := HashAPIKey(key)
+
+	s.mu.Lock()
+	verifiedAt, known := s.verified[hash]
+	s.mu.Unlock()
+	if known && time.Since(verifiedAt) < apiKeyVerifyTTL {
+		return true, nil
+	}
+
+	active, err := s.repo.IsActiveAPIKey(ctx, hash)
+	if err != nil {
+		if known && repo.IsTransientError(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to verify api key: %w", err)
+	}
+
+	s.mu.Lock()
+	if active {
+		s.verified[hash] = time.Now()
+	} else {
+		delete(s.verified, hash)
+	}
+	s.mu.Unlock()
+	return active, nil
+}
+
+// HashAPIKey returns the hex SHA-256 of key, as stored in api_keys.key_hash
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
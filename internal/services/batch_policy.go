@@ -0,0 +1,131 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/config"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+// BatchConfig bounds how clicks are grouped before being written
+type BatchConfig struct {
+	MinSize    int           // smallest size the adaptive policy will shrink to
+	MaxSize    int           // flush once this many clicks are buffered
+	MaxBytes   int           // flush once the buffered clicks reach this estimated size
+	MinLatency time.Duration // shortest linger the adaptive policy will use
+	MaxLatency time.Duration // flush once the oldest buffered click is this old
+
+	// Adaptive lets size and linger move between their min and max based on
+	// observed insert latency and backlog; otherwise the max values are fixed.
+	Adaptive            bool
+	TargetInsertLatency time.Duration
+
+	// QueueSize bounds the clicks waiting for the writer; enqueueing fails
+	// instead of blocking once it is full.
+	QueueSize int
+
+	// Transient write failures are retried with exponential backoff and
+	// jitter, starting at RetryBaseDelay and capped at RetryMaxDelay
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// NewBatchConfig builds a BatchConfig from application configuration
+func NewBatchConfig(cfg *config.Config) BatchConfig {
+	return BatchConfig{
+		MinSize:             cfg.BatchMinSize,
+		MaxSize:             cfg.BatchMaxSize,
+		MaxBytes:            cfg.BatchMaxBytes,
+		MinLatency:          cfg.BatchMinLatency,
+		MaxLatency:          cfg.BatchMaxLatency,
+		Adaptive:            cfg.BatchAdaptive,
+		TargetInsertLatency: cfg.BatchTargetInsertLatency,
+		QueueSize:           cfg.BatchQueueSize,
+		RetryBaseDelay:      cfg.BatchRetryBaseDelay,
+		RetryMaxDelay:       cfg.BatchRetryMaxDelay,
+	}
+}
+
+// batchPolicy tracks the current batch size and linger. With adaptation on it
+// grows the batch while a backlog builds up and inserts stay fast (peak
+// traffic), shrinks it when inserts get slow, and shortens the linger when
+// batches flush on the timer half empty (quiet periods) so clicks land sooner.
+type batchPolicy struct {
+	mu      sync.Mutex
+	cfg     BatchConfig
+	size    int
+	latency time.Duration
+}
+
+func newBatchPolicy(cfg BatchConfig) *batchPolicy {
+	if cfg.MinSize <= 0 || cfg.MinSize > cfg.MaxSize {
+		cfg.MinSize = cfg.MaxSize
+	}
+	if cfg.MinLatency <= 0 || cfg.MinLatency > cfg.MaxLatency {
+		cfg.MinLatency = cfg.MaxLatency
+	}
+
+	// Adaptive batching starts small and grows under load
+	size := cfg.MaxSize
+	if cfg.Adaptive {
+		size = cfg.MinSize
+	}
+
+	return &batchPolicy{
+		cfg:     cfg,
+		size:    size,
+		latency: cfg.MaxLatency,
+	}
+}
+
+// tickInterval is how often a time-based flush should be checked for
+func (p *batchPolicy) tickInterval() time.Duration {
+	return max(p.cfg.MinLatency/2, 10*time.Millisecond)
+}
+
+// limits returns the current flush thresholds
+func (p *batchPolicy) limits() (size, maxBytes int, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size, p.cfg.MaxBytes, p.latency
+}
+
+// shouldFlush reports whether a buffer of n clicks, bytes in size, whose
+// oldest click is age old has hit any threshold
+func (p *batchPolicy) shouldFlush(n, bytes int, age time.Duration) bool {
+	size, maxBytes, latency := p.limits()
+	return n >= size || (maxBytes > 0 && bytes >= maxBytes) || (n > 0 && age >= latency)
+}
+
+// observe feeds back the outcome of a flush
+func (p *batchPolicy) observe(batchSize int, insertLatency time.Duration, backlog int) {
+	if !p.cfg.Adaptive {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.cfg.TargetInsertLatency > 0 && insertLatency > p.cfg.TargetInsertLatency:
+		// Postgres is struggling with the batch size: back off
+		p.size = max(p.cfg.MinSize, p.size*3/4)
+	case backlog > 0 || batchSize >= p.size:
+		// Clicks arrive faster than we flush: bigger batches, longer linger
+		p.size = min(p.cfg.MaxSize, p.size*2)
+		p.latency = min(p.cfg.MaxLatency, p.latency*5/4)
+	case batchSize < p.size/2:
+		// Quiet period: flush sooner to keep end-to-end latency down
+		p.latency = max(p.cfg.MinLatency, p.latency*3/4)
+	}
+
+	metrics.UpdateBatchTargets(p.size, p.latency.Seconds())
+}
+
+// estimateClickBytes approximates a click's footprint in the insert payload
+func estimateClickBytes(c model.Clicks) int {
+	// id, ad_id and ip are strings; playback_time and timestamp are 8 bytes each
+	return len(c.ID) + len(c.AdID) + len(c.IP) + 16
+}
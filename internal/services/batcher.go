@@ -0,0 +1,462 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+const (
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
+)
+
+var (
+	// ErrBatchQueueFull is returned when clicks arrive faster than they can be
+	// persisted, e.g. while Postgres is down and a failed batch is pending
+	ErrBatchQueueFull = errors.New("click batch queue is full")
+
+	// ErrBatcherStopped is returned for clicks enqueued after shutdown began
+	ErrBatcherStopped = errors.New("click batcher is stopped")
+)
+
+// batchTarget is where the batcher sends clicks
+type batchTarget struct {
+	write      func(ctx context.Context, clicks []model.Clicks) error
+	quarantine func(ctx context.Context, clicks []model.Clicks, reason string) error
+
+	// spool takes batches while the database breaker is open and gives them
+	// back once available reports it no longer is; a nil spool disables this
+	spool     *ClickSpool
+	available func() bool
+}
+
+// clickBatcher buffers clicks on a bounded queue and persists them from a
+// single writer goroutine, so enqueueing never waits on the database. A batch
+// that fails transiently is set aside and retried with backoff; while it is
+// pending the writer fills at most one more batch and then stops reading,
+// which lets the queue fill up and push back on callers instead of growing
+// memory without bound. A batch that fails permanently is split in halves
+// until the offending clicks are found, and those are quarantined. While the
+// database breaker is open, batches go to the disk spool instead and are
+// drained back once it closes.
+type clickBatcher struct {
+	queue   chan model.Clicks
+	flushCh chan chan error
+	done    chan struct{} // closed to ask the writer to drain and exit
+	exited  chan struct{} // closed once the writer has exited
+
+	mu      sync.RWMutex
+	running bool
+	closing bool
+	stopErr error
+
+	batchTarget
+	policy    *batchPolicy
+	log       *logger.Logger
+	retryBase time.Duration
+	retryMax  time.Duration
+
+	// heartbeat is the UnixNano time of the writer loop's last iteration
+	heartbeat atomic.Int64
+
+	// Owned by the writer goroutine
+	batch          []model.Clicks
+	batchBytes     int
+	batchStartedAt time.Time
+	failed         []model.Clicks
+	attempts       int
+	retryAt        time.Time
+
+	// Deletes the spool segment the failed batch was drained from, once the
+	// batch is written or spooled again
+	failedAck func() error
+}
+
+func newClickBatcher(cfg BatchConfig, target batchTarget, log *logger.Logger) *clickBatcher {
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10 * max(cfg.MaxSize, 1)
+	}
+
+	retryBase, retryMax := cfg.RetryBaseDelay, cfg.RetryMaxDelay
+	if retryBase <= 0 {
+		retryBase = defaultRetryBaseDelay
+	}
+	if retryMax <= 0 {
+		retryMax = defaultRetryMaxDelay
+	}
+	retryMax = max(retryMax, retryBase)
+
+	return &clickBatcher{
+		queue:       make(chan model.Clicks, queueSize),
+		flushCh:     make(chan chan error),
+		done:        make(chan struct{}),
+		exited:      make(chan struct{}),
+		batchTarget: target,
+		policy:      newBatchPolicy(cfg),
+		log:         log,
+		retryBase:   retryBase,
+		retryMax:    retryMax,
+	}
+}
+
+// enqueue hands a click to the writer without blocking
+func (b *clickBatcher) enqueue(click model.Clicks) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closing {
+		return ErrBatcherStopped
+	}
+
+	select {
+	case b.queue <- click:
+		return nil
+	default:
+		metrics.RecordError("batch_queue_full", "ads_service")
+		return ErrBatchQueueFull
+	}
+}
+
+// start launches the writer goroutine
+func (b *clickBatcher) start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.running || b.closing {
+		return
+	}
+	b.running = true
+	go b.run()
+}
+
+// flush writes everything buffered so far, including a pending failed batch
+func (b *clickBatcher) flush(ctx context.Context) error {
+	b.mu.RLock()
+	running := b.running
+	b.mu.RUnlock()
+	if !running {
+		return fmt.Errorf("click batcher is not running")
+	}
+
+	reply := make(chan error, 1)
+	select {
+	case b.flushCh <- reply:
+	case <-b.exited:
+		return ErrBatcherStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// The writer finishes the flush even if we stop waiting for it
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop rejects new clicks, drains the queue and writes what is left
+func (b *clickBatcher) stop(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closing {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closing = true
+	running := b.running
+	b.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	close(b.done)
+	select {
+	case <-b.exited:
+		return b.stopErr
+	case <-ctx.Done():
+		return fmt.Errorf("click batcher did not drain in time: %w", ctx.Err())
+	}
+}
+
+func (b *clickBatcher) run() {
+	defer close(b.exited)
+
+	ticker := time.NewTicker(b.policy.tickInterval())
+	defer ticker.Stop()
+
+	for {
+		b.heartbeat.Store(time.Now().UnixNano())
+
+		// With a failed batch pending, stop reading once the next batch is
+		// full so the bounded queue applies backpressure
+		queue := b.queue
+		if b.failed != nil && b.policy.shouldFlush(len(b.batch), b.batchBytes, 0) {
+			queue = nil
+		}
+
+		select {
+		case click := <-queue:
+			b.add(click)
+			if b.failed == nil && b.policy.shouldFlush(len(b.batch), b.batchBytes, 0) {
+				_ = b.flushCurrent()
+			}
+
+		case <-ticker.C:
+			if b.failed != nil {
+				if time.Now().Before(b.retryAt) {
+					continue
+				}
+				if err := b.retryFailed(); err != nil {
+					continue
+				}
+			}
+			if b.policy.shouldFlush(len(b.batch), b.batchBytes, time.Since(b.batchStartedAt)) {
+				_ = b.flushCurrent()
+			}
+			if b.failed == nil {
+				b.drainSpool()
+			}
+
+		case reply := <-b.flushCh:
+			reply <- b.flushAll()
+
+		case <-b.done:
+			b.drain()
+			if err := b.flushAll(); err != nil {
+				b.stopErr = b.spoolLeftovers(err)
+			}
+			return
+		}
+	}
+}
+
+// backlog returns how many clicks are queued and how many the queue can hold
+func (b *clickBatcher) backlog() (queued, capacity int) {
+	return len(b.queue), cap(b.queue)
+}
+
+// lastHeartbeat returns when the writer loop last went round; zero before start
+func (b *clickBatcher) lastHeartbeat() time.Time {
+	nanos := b.heartbeat.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+func (b *clickBatcher) add(click model.Clicks) {
+	if len(b.batch) == 0 {
+		b.batchStartedAt = time.Now()
+	}
+	b.batch = append(b.batch, click)
+	b.batchBytes += estimateClickBytes(click)
+}
+
+// drain moves whatever is still queued into the current batch
+func (b *clickBatcher) drain() {
+	for {
+		select {
+		case click := <-b.queue:
+			b.add(click)
+		default:
+			return
+		}
+	}
+}
+
+// flushAll retries a pending failed batch, then writes the current one
+func (b *clickBatcher) flushAll() error {
+	if b.failed != nil {
+		if err := b.retryFailed(); err != nil {
+			return err
+		}
+	}
+	return b.flushCurrent()
+}
+
+// flushCurrent writes the current batch
+func (b *clickBatcher) flushCurrent() error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+
+	batch, age := b.batch, time.Since(b.batchStartedAt)
+	b.batch, b.batchBytes = nil, 0
+
+	metrics.RecordBatch(len(batch), age.Seconds())
+	return b.persist(batch)
+}
+
+// retryFailed writes the pending failed batch again
+func (b *clickBatcher) retryFailed() error {
+	batch := b.failed
+	b.failed = nil
+	metrics.RecordBatchRetry()
+
+	if err := b.persist(batch); err != nil {
+		return err
+	}
+
+	b.log.Logger.Infof("Batch of %d clicks handled after %d retries", len(batch), b.attempts)
+	b.attempts = 0
+	b.ackSegment()
+	return nil
+}
+
+// persist writes a batch. Clicks that fail transiently are set aside for a
+// retry; a permanent failure is narrowed down to the offending clicks, which
+// are quarantined so they can't hold up the rest.
+func (b *clickBatcher) persist(batch []model.Clicks) error {
+	err := b.writeBatch(batch)
+	if err == nil {
+		return nil
+	}
+
+	retry := batch
+	if !repo.IsTransientError(err) {
+		b.log.Logger.Warnf("Batch of %d clicks failed permanently, isolating bad clicks: %v", len(batch), err)
+		retry = b.isolate(batch, err)
+		if len(retry) == 0 {
+			return nil
+		}
+	}
+
+	// No point retrying in memory while the breaker is rejecting writes
+	if errors.Is(err, breaker.ErrCircuitBreakerOpen) && b.spool != nil {
+		spoolErr := b.spool.Append(retry)
+		if spoolErr == nil {
+			b.log.Logger.Warnf("Database unavailable, spooled %d clicks to disk", len(retry))
+			return nil
+		}
+		b.log.Logger.Errorf("Failed to spool %d clicks: %v", len(retry), spoolErr)
+	}
+
+	b.failed = retry
+	b.attempts++
+	delay := b.retryDelay(b.attempts)
+	b.retryAt = time.Now().Add(delay)
+	b.log.Logger.Errorf("Failed to write %d clicks (attempt %d), retrying in %s: %v", len(retry), b.attempts, delay, err)
+	return err
+}
+
+// isolate bisects a batch that failed permanently, writing the halves that
+// succeed and quarantining single clicks that still fail. Clicks that hit a
+// transient error along the way are returned to be retried.
+func (b *clickBatcher) isolate(batch []model.Clicks, cause error) []model.Clicks {
+	if len(batch) == 1 {
+		if err := b.quarantine(context.Background(), batch, cause.Error()); err != nil {
+			clickLogger(b.log, batch[0]).Logger.Errorf("Failed to quarantine click %s: %v", batch[0].ID, err)
+			return batch
+		}
+		metrics.RecordQuarantinedClicks(1)
+		clickLogger(b.log, batch[0]).Logger.Warnf("Quarantined click %s for ad %s: %v", batch[0].ID, batch[0].AdID, cause)
+		return nil
+	}
+
+	var retry []model.Clicks
+	mid := len(batch) / 2
+	for _, half := range [][]model.Clicks{batch[:mid], batch[mid:]} {
+		err := b.writeBatch(half)
+		switch {
+		case err == nil:
+		case repo.IsTransientError(err):
+			retry = append(retry, half...)
+		default:
+			retry = append(retry, b.isolate(half, err)...)
+		}
+	}
+	return retry
+}
+
+// drainSpool hands one spooled segment back to the writer once the database
+// breaker is no longer open. In half-open the segment is the probe: if its
+// write fails the breaker reopens and the clicks are spooled again.
+func (b *clickBatcher) drainSpool() {
+	if b.spool == nil || b.spool.Pending() == 0 || !b.available() {
+		return
+	}
+
+	clicks, ack, err := b.spool.Next()
+	if err != nil {
+		b.log.Logger.Errorf("Failed to read click spool: %v", err)
+		return
+	}
+	if len(clicks) == 0 {
+		return
+	}
+
+	// The segment stays on disk while its clicks wait for a retry in memory
+	b.log.Logger.Infof("Draining %d spooled clicks", len(clicks))
+	b.failedAck = ack
+	if err := b.persist(clicks); err != nil {
+		return
+	}
+	b.ackSegment()
+}
+
+// ackSegment deletes the spool segment the last drained batch came from
+func (b *clickBatcher) ackSegment() {
+	if b.failedAck == nil {
+		return
+	}
+	ack := b.failedAck
+	b.failedAck = nil
+	if err := ack(); err != nil {
+		b.log.Logger.Errorf("Failed to remove drained spool segment: %v", err)
+	}
+}
+
+// spoolLeftovers saves whatever could not be written at shutdown
+func (b *clickBatcher) spoolLeftovers(cause error) error {
+	leftovers := append(b.failed, b.batch...)
+	if b.spool != nil {
+		if err := b.spool.Append(leftovers); err == nil {
+			b.ackSegment()
+			b.log.Logger.Warnf("Spooled %d unwritten clicks at shutdown: %v", len(leftovers), cause)
+			return nil
+		}
+	}
+
+	b.log.Logger.Errorf("Dropping %d unwritten clicks at shutdown: %v", len(leftovers), cause)
+	return cause
+}
+
+// retryDelay doubles from the base delay per attempt up to the maximum, with
+// jitter over the upper half so replicas that failed together don't retry
+// in lockstep
+func (b *clickBatcher) retryDelay(attempt int) time.Duration {
+	delay := b.retryBase << min(attempt-1, 20)
+	if delay <= 0 || delay > b.retryMax {
+		delay = b.retryMax
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (b *clickBatcher) writeBatch(batch []model.Clicks) error {
+	// Batches outlive the requests that queued their clicks, so writes get a
+	// fresh context; the repository bounds each one with its batch timeout
+	start := time.Now()
+	if err := b.write(context.Background(), batch); err != nil {
+		metrics.RecordError("batch_save_error", "ads_service")
+		return err
+	}
+
+	backlog := len(b.queue)
+	b.policy.observe(len(batch), time.Since(start), backlog)
+	metrics.UpdateQueueSize("click_batch", float64(backlog))
+	return nil
+}
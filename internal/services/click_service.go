@@ -1,7 +1,10 @@
 package services
 
 import (
+	"context"
+
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
 )
 
 // ClickService handles click processing for Kafka consumers
@@ -16,7 +19,17 @@ func NewClickService(adsService *AdsService) *ClickService {
 	}
 }
 
+// clickLogger returns log tagged with the click's ID, ad and originating
+// request, for work that no longer has the request's context
+func clickLogger(log *logger.Logger, click model.Clicks) *logger.Logger {
+	fields := []interface{}{logger.FieldClickID, click.ID, logger.FieldAdID, click.AdID}
+	if click.RequestID != "" {
+		fields = append(fields, logger.FieldRequestID, click.RequestID)
+	}
+	return log.With(fields...)
+}
+
 // ProcessClick processes a click event (implements the interface expected by Kafka consumer)
-func (cs *ClickService) ProcessClick(click model.Clicks) error {
-	return cs.AdsService.ProcessClick(click)
+func (cs *ClickService) ProcessClick(ctx context.Context, click model.Clicks) error {
+	return cs.AdsService.ProcessClick(ctx, click)
 }
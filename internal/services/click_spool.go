@@ -0,0 +1,340 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+const (
+	spoolSegmentPrefix = "clicks-"
+	spoolSegmentSuffix = ".jsonl"
+
+	// Suffix added to a segment taken by Next until its clicks are written
+	spoolInflightSuffix = ".inflight"
+)
+
+// ErrSpoolFull is returned when appending would take the spool past its size limit
+var ErrSpoolFull = errors.New("click spool is full")
+
+// ClickSpool is a local disk buffer for clicks that can't reach Postgres.
+// Clicks are appended as JSON lines to segment files of at most segmentSize
+// clicks, and synced to disk before Append returns; the batch writer takes
+// whole segments back, oldest first, once the database is available again. A
+// taken segment stays on disk until its clicks are written, so a crash while
+// draining replays it instead of losing it.
+type ClickSpool struct {
+	mu          sync.Mutex
+	dir         string
+	maxBytes    int64
+	segmentSize int
+	seq         int
+
+	active      *os.File
+	activeBuf   *bufio.Writer
+	activeCount int
+
+	bytes   int64 // bytes on disk across all segments
+	pending int64 // clicks on disk across all segments
+}
+
+// NewClickSpool opens (or creates) the spool in dir, picking up segments left
+// by a previous run
+func NewClickSpool(dir string, maxBytes int64, segmentSize int) (*ClickSpool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &ClickSpool{
+		dir:         dir,
+		maxBytes:    maxBytes,
+		segmentSize: max(segmentSize, 1),
+	}
+
+	// Segments a previous run was draining when it died go back in line;
+	// their clicks may be written twice, which the writers skip
+	if err := s.reclaimInflight(); err != nil {
+		return nil, err
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range segments {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		clicks, err := readSegment(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		s.bytes += info.Size()
+		s.pending += int64(len(clicks))
+	}
+
+	metrics.UpdateSpoolBacklog(s.pending)
+	return s, nil
+}
+
+// Append writes clicks to the active segment
+func (s *ClickSpool) Append(clicks []model.Clicks) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := make([][]byte, 0, len(clicks))
+	size := int64(0)
+	for _, click := range clicks {
+		line, err := json.Marshal(newSpoolRecord(click))
+		if err != nil {
+			return fmt.Errorf("failed to encode click: %w", err)
+		}
+		lines = append(lines, line)
+		size += int64(len(line)) + 1
+	}
+	if s.maxBytes > 0 && s.bytes+size > s.maxBytes {
+		metrics.RecordError("spool_full", "click_spool")
+		return ErrSpoolFull
+	}
+
+	for _, line := range lines {
+		if s.active == nil {
+			if err := s.openSegment(); err != nil {
+				return err
+			}
+		}
+		if _, err := s.activeBuf.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write to spool: %w", err)
+		}
+
+		s.activeCount++
+		s.bytes += int64(len(line)) + 1
+		s.pending++
+		if s.activeCount >= s.segmentSize {
+			if err := s.closeSegment(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The clicks are only safe once they are on disk, not in the page cache
+	if s.activeBuf != nil {
+		if err := s.activeBuf.Flush(); err != nil {
+			return fmt.Errorf("failed to write to spool: %w", err)
+		}
+		if err := s.active.Sync(); err != nil {
+			return fmt.Errorf("failed to sync spool segment: %w", err)
+		}
+	}
+
+	metrics.RecordSpooled(len(clicks), s.pending)
+	return nil
+}
+
+// Next takes the oldest segment and returns its clicks, or nil if the spool
+// is empty. The segment is renamed to *.inflight rather than deleted; ack
+// deletes it once the clicks are written or safely elsewhere. Until then, a
+// restart puts the segment back in line.
+func (s *ClickSpool) Next() (clicks []model.Clicks, ack func() error, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == 0 {
+		return nil, nil, nil
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(segments) == 0 {
+		return nil, nil, nil
+	}
+
+	path := filepath.Join(s.dir, segments[0])
+	if s.active != nil && s.active.Name() == path {
+		if err := s.closeSegment(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	clicks, err = readSegment(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	inflight := path + spoolInflightSuffix
+	if err := os.Rename(path, inflight); err != nil {
+		return nil, nil, fmt.Errorf("failed to take spool segment: %w", err)
+	}
+
+	s.pending -= int64(len(clicks))
+	metrics.RecordDrained(len(clicks), s.pending)
+
+	ack = func() error {
+		if err := os.Remove(inflight); err != nil {
+			return fmt.Errorf("failed to remove spool segment: %w", err)
+		}
+		s.mu.Lock()
+		s.bytes -= info.Size()
+		s.mu.Unlock()
+		return nil
+	}
+	return clicks, ack, nil
+}
+
+// reclaimInflight renames segments left in flight back to pending ones
+func (s *ClickSpool) reclaimInflight() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix+spoolInflightSuffix) {
+			continue
+		}
+		path := filepath.Join(s.dir, name)
+		if err := os.Rename(path, strings.TrimSuffix(path, spoolInflightSuffix)); err != nil {
+			return fmt.Errorf("failed to reclaim spool segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of clicks on disk
+func (s *ClickSpool) Pending() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Close syncs and closes the active segment
+func (s *ClickSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeSegment()
+}
+
+func (s *ClickSpool) openSegment() error {
+	s.seq++
+	name := fmt.Sprintf("%s%020d-%06d%s", spoolSegmentPrefix, time.Now().UnixNano(), s.seq, spoolSegmentSuffix)
+
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+
+	s.active = f
+	s.activeBuf = bufio.NewWriter(f)
+	s.activeCount = 0
+	return nil
+}
+
+func (s *ClickSpool) closeSegment() error {
+	if s.active == nil {
+		return nil
+	}
+
+	f, buf := s.active, s.activeBuf
+	s.active, s.activeBuf, s.activeCount = nil, nil, 0
+
+	if err := buf.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write to spool: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	return f.Close()
+}
+
+// segments lists segment file names, oldest first
+func (s *ClickSpool) segments() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, spoolSegmentPrefix) && strings.HasSuffix(name, spoolSegmentSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func readSegment(path string) ([]model.Clicks, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var clicks []model.Clicks
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record spoolRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A torn last line from a crash mid-write; everything before it is intact
+			break
+		}
+		clicks = append(clicks, record.click())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spool segment %s: %w", filepath.Base(path), err)
+	}
+	return clicks, nil
+}
+
+// spoolRecord is a spooled click plus the pipeline timings its own JSON
+// leaves out, so a drained click still reports its end-to-end latency
+type spoolRecord struct {
+	model.Clicks
+	IngestedAt *time.Time `json:"ingested_at,omitempty"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+}
+
+func newSpoolRecord(click model.Clicks) spoolRecord {
+	record := spoolRecord{Clicks: click}
+	if !click.IngestedAt.IsZero() {
+		record.IngestedAt = &click.IngestedAt
+	}
+	if !click.ConsumedAt.IsZero() {
+		record.ConsumedAt = &click.ConsumedAt
+	}
+	return record
+}
+
+func (r spoolRecord) click() model.Clicks {
+	click := r.Clicks
+	if r.IngestedAt != nil {
+		click.IngestedAt = *r.IngestedAt
+	}
+	if r.ConsumedAt != nil {
+		click.ConsumedAt = *r.ConsumedAt
+	}
+	return click
+}
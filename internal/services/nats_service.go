@@ -1,32 +1,58 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ClickSubject is the NATS subject clicks are published to and consumed from
+const ClickSubject = "ad.clicks"
+
+// Headers carrying a click's pipeline timings (RFC 3339 with nanoseconds)
+const (
+	HeaderIngestedAt  = "Ingested-At"
+	HeaderPublishedAt = "Published-At"
+)
+
+// HeaderRequestID carries the ID of the API request a click came in with, so
+// consumer logs on any replica can be matched to it
+const HeaderRequestID = "X-Request-ID"
+
+// natsMessagingSystem identifies NATS on messaging spans; semconv has no constant for it
+var natsMessagingSystem = semconv.MessagingSystemKey.String("nats")
+
 const (
-	subjectName = "ad.clicks"
-	queueGroup  = "ad-clicks-workers"
-	maxRetries  = 5
-	retryDelay  = 2 * time.Second
+	queueGroup = "ad-clicks-workers"
+	maxRetries = 5
+	retryDelay = 2 * time.Second
 )
 
+// ClickProcessTimeout bounds processing a click outside of any request: a
+// consumed NATS message, or a click handed off by the HTTP handler
+const ClickProcessTimeout = 10 * time.Second
+
 type NATSService struct {
 	conn    *nats.Conn
 	log     *logger.Logger
+	cb      *breaker.CircuitBreaker
 	natsURL string
 	subs    []*nats.Subscription
 }
 
-// NewNATSService creates a new NATS service instance
-func NewNATSService(natsURL string, log *logger.Logger) (*NATSService, error) {
+// NewNATSService creates a new NATS service instance; publishes go through cb
+func NewNATSService(natsURL string, cb *breaker.CircuitBreaker, log *logger.Logger) (*NATSService, error) {
 	if natsURL == "" {
 		natsURL = nats.DefaultURL
 	}
@@ -69,26 +95,52 @@ func NewNATSService(natsURL string, log *logger.Logger) (*NATSService, error) {
 	return &NATSService{
 		conn:    conn,
 		log:     log,
+		cb:      cb,
 		natsURL: natsURL,
 		subs:    make([]*nats.Subscription, 0),
 	}, nil
 }
 
-// PublishClick publishes a click event to NATS
-func (s *NATSService) PublishClick(click model.Clicks) error {
+// PublishClick publishes a click event to NATS, carrying ctx's trace context
+// in the message headers
+func (s *NATSService) PublishClick(ctx context.Context, click model.Clicks) (err error) {
+	ctx, span := tracing.Start(ctx, ClickSubject+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			natsMessagingSystem,
+			semconv.MessagingDestinationName(ClickSubject),
+			semconv.MessagingOperationTypePublish,
+			tracing.AttrClickID.String(click.ID),
+			tracing.AttrAdID.String(click.AdID),
+		))
+	defer func() { tracing.End(span, err) }()
+
 	data, err := json.Marshal(click)
 	if err != nil {
 		metrics.RecordError("marshal_click_error", "nats_service")
 		return fmt.Errorf("failed to marshal click: %w", err)
 	}
 
-	err = s.conn.Publish(subjectName, data)
+	msg := nats.NewMsg(ClickSubject)
+	msg.Data = data
+	if !click.IngestedAt.IsZero() {
+		msg.Header.Set(HeaderIngestedAt, click.IngestedAt.Format(time.RFC3339Nano))
+	}
+	if click.RequestID != "" {
+		msg.Header.Set(HeaderRequestID, click.RequestID)
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(msg.Header))
+
+	err = s.cb.CallContext(ctx, func(ctx context.Context) error {
+		msg.Header.Set(HeaderPublishedAt, time.Now().Format(time.RFC3339Nano))
+		return s.conn.PublishMsg(msg)
+	})
 	if err != nil {
 		metrics.RecordError("nats_publish_error", "nats_service")
 		return fmt.Errorf("failed to publish click to NATS: %w", err)
 	}
 
-	s.log.Logger.Debugf("Click published to NATS subject: %s", subjectName)
+	logger.FromContext(ctx, s.log).Logger.Debugf("Click published to NATS subject: %s", ClickSubject)
 	return nil
 }
 
@@ -96,20 +148,8 @@ func (s *NATSService) PublishClick(click model.Clicks) error {
 func (s *NATSService) StartConsumer(clickService *ClickService, numWorkers int) error {
 	// Create multiple queue subscribers for load balancing
 	for i := 0; i < numWorkers; i++ {
-		sub, err := s.conn.QueueSubscribe(subjectName, queueGroup, func(msg *nats.Msg) {
-			var click model.Clicks
-			if err := json.Unmarshal(msg.Data, &click); err != nil {
-				s.log.Logger.Errorf("Failed to unmarshal click: %v", err)
-				return
-			}
-
-			if err := clickService.ProcessClick(click); err != nil {
-				s.log.Logger.Errorf("Failed to process click: %v", err)
-				// Implement retry logic if needed
-				return
-			}
-
-			s.log.Logger.Debugf("Successfully processed click for ad: %s", click.AdID)
+		sub, err := s.conn.QueueSubscribe(ClickSubject, queueGroup, func(msg *nats.Msg) {
+			s.handleClick(clickService, msg)
 		})
 
 		if err != nil {
@@ -124,6 +164,91 @@ func (s *NATSService) StartConsumer(clickService *ClickService, numWorkers int)
 	return nil
 }
 
+// handleClick processes one consumed click in a span continuing the trace
+// the publisher left in the message headers
+func (s *NATSService) handleClick(clickService *ClickService, msg *nats.Msg) {
+	consumedAt := time.Now()
+
+	ctx := tracing.Extract(context.Background(), propagation.HeaderCarrier(msg.Header))
+	ctx, span := tracing.Start(ctx, ClickSubject+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			natsMessagingSystem,
+			semconv.MessagingDestinationName(msg.Subject),
+			semconv.MessagingConsumerGroupName(queueGroup),
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingMessageBodySize(len(msg.Data)),
+		))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	var click model.Clicks
+	if err = json.Unmarshal(msg.Data, &click); err != nil {
+		s.log.Logger.Errorf("Failed to unmarshal click: %v", err)
+		return
+	}
+	span.SetAttributes(tracing.AttrClickID.String(click.ID), tracing.AttrAdID.String(click.AdID))
+
+	click.RequestID = msg.Header.Get(HeaderRequestID)
+	log := clickLogger(s.log, click)
+	ctx = logger.NewContext(ctx, log)
+
+	click.IngestedAt = headerTime(msg, HeaderIngestedAt)
+	click.ConsumedAt = consumedAt
+	if publishedAt := headerTime(msg, HeaderPublishedAt); !publishedAt.IsZero() {
+		metrics.RecordClickStageLatency(metrics.StagePublishToConsume, consumedAt.Sub(publishedAt))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ClickProcessTimeout)
+	defer cancel()
+
+	if err = clickService.ProcessClick(ctx, click); err != nil {
+		log.Logger.Errorf("Failed to process click: %v", err)
+		// Implement retry logic if needed
+		return
+	}
+
+	log.Logger.Debugf("Successfully processed click for ad: %s", click.AdID)
+}
+
+// headerTime parses a timing header; zero if it is missing or malformed
+func headerTime(msg *nats.Msg, key string) time.Time {
+	if msg.Header == nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, msg.Header.Get(key))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// StopConsumers stops taking new messages and waits for the ones already
+// delivered to be processed, or for ctx to be done
+func (s *NATSService) StopConsumers(ctx context.Context) error {
+	for _, sub := range s.subs {
+		if err := sub.Drain(); err != nil {
+			return fmt.Errorf("failed to drain NATS subscription: %w", err)
+		}
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for _, sub := range s.subs {
+		for sub.IsValid() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+
+	s.subs = nil
+	s.log.Logger.Info("NATS consumers stopped")
+	return nil
+}
+
 // Close gracefully closes the NATS connection and unsubscribes
 func (s *NATSService) Close() error {
 	// Unsubscribe from all subscriptions
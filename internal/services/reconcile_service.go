@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+// AdDrift describes a single ad whose total_clicks counter disagrees with
+// the clicks table
+type AdDrift struct {
+	AdID    string `json:"ad_id"`
+	Counter int64  `json:"counter"`
+	Actual  int64  `json:"actual"`
+	Drift   int64  `json:"drift"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// ReconcileReport summarises a reconciliation run
+type ReconcileReport struct {
+	CheckedAds int           `json:"checked_ads"`
+	DriftedAds int           `json:"drifted_ads"`
+	TotalDrift int64         `json:"total_drift"`
+	FixedAds   int           `json:"fixed_ads"`
+	Drifts     []AdDrift     `json:"drifts"`
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// ErrFixWithRetention is returned when a fix is asked for while click
+// retention is on: the counter is all-time, the remaining rows are not
+var ErrFixWithRetention = errors.New("click counters can't be fixed while CLICKS_RETENTION_DAYS drops old clicks")
+
+// ReconcileService recomputes Ad.TotalClicks from stored click rows and
+// optionally repairs counters that have drifted
+type ReconcileService struct {
+	adsRepo *repo.AdsRepository
+	log     *logger.Logger
+
+	// Old clicks partitions are dropped, so counters legitimately exceed rows
+	retention bool
+}
+
+// NewReconcileService creates a new ReconcileService. retentionDays is
+// CLICKS_RETENTION_DAYS.
+func NewReconcileService(adsRepo *repo.AdsRepository, retentionDays int, log *logger.Logger) *ReconcileService {
+	return &ReconcileService{
+		adsRepo:   adsRepo,
+		log:       log,
+		retention: retentionDays > 0,
+	}
+}
+
+// Reconcile compares every ad's counter against its click rows. With fix set,
+// drifted counters are overwritten unless they changed since being read.
+//
+// With retention on, a counter above its row count is expected and only one
+// below it is reported; fixing is refused because the true total is unknown.
+func (s *ReconcileService) Reconcile(ctx context.Context, fix bool) (*ReconcileReport, error) {
+	if fix && s.retention {
+		return nil, ErrFixWithRetention
+	}
+
+	report := &ReconcileReport{StartedAt: time.Now()}
+
+	rows, err := s.adsRepo.CompareClickTotals(ctx)
+	if err != nil {
+		metrics.RecordError("reconcile_error", "reconcile_service")
+		return nil, fmt.Errorf("failed to compare click totals: %w", err)
+	}
+	report.CheckedAds = len(rows)
+
+	for _, row := range rows {
+		if row.Counter == row.Actual || (s.retention && row.Counter > row.Actual) {
+			continue
+		}
+
+		drift := AdDrift{
+			AdID:    strings.TrimSpace(row.AdID),
+			Counter: row.Counter,
+			Actual:  row.Actual,
+			Drift:   row.Counter - row.Actual,
+		}
+
+		if fix {
+			fixed, err := s.adsRepo.SetAdTotalClicks(ctx, row.AdID, row.Counter, row.Actual)
+			if err != nil {
+				s.log.Logger.Errorf("Failed to fix total clicks for ad %s: %v", drift.AdID, err)
+			} else if !fixed {
+				s.log.Logger.Warnf("Total clicks for ad %s changed during reconciliation, skipping fix", drift.AdID)
+			}
+			drift.Fixed = fixed
+			if fixed {
+				report.FixedAds++
+			}
+		}
+
+		report.DriftedAds++
+		report.TotalDrift += abs64(drift.Drift)
+		report.Drifts = append(report.Drifts, drift)
+	}
+
+	report.Duration = time.Since(report.StartedAt)
+	metrics.RecordClickDrift(report.DriftedAds, report.TotalDrift)
+
+	return report, nil
+}
+
+// StartReconciler runs Reconcile periodically in the background until ctx is done
+func (s *ReconcileService) StartReconciler(ctx context.Context, interval time.Duration, fix bool) {
+	if interval <= 0 {
+		s.log.Logger.Info("Click counter reconciliation disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// A run must not overlap the next one
+			runCtx, cancel := context.WithTimeout(ctx, interval)
+			report, err := s.Reconcile(runCtx, fix)
+			cancel()
+			if err != nil {
+				s.log.Logger.Errorf("Click counter reconciliation failed: %v", err)
+				continue
+			}
+
+			if report.DriftedAds > 0 {
+				s.log.Logger.Warnw("Click counter drift detected",
+					"checked_ads", report.CheckedAds,
+					"drifted_ads", report.DriftedAds,
+					"total_drift", report.TotalDrift,
+					"fixed_ads", report.FixedAds)
+			}
+		}
+	}()
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
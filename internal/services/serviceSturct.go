@@ -1,26 +1,26 @@
 package services
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/model"
 	"github.com/ratheeshkumar25/adsmetrictracker/internal/repo"
-	"github.com/ratheeshkumar25/adsmetrictracker/pkg/breaker"
 	"github.com/ratheeshkumar25/adsmetrictracker/pkg/logger"
 )
 
 type AdsServiceInt interface {
-	GetAdsAllAds() ([]model.Ad, error)
-	ProcessClick(click model.Clicks) error
-	ProcessBatch() error
+	GetAdsAllAds(ctx context.Context) ([]model.Ad, error)
+	ProcessClick(ctx context.Context, click model.Clicks) error
+	ProcessBatch(ctx context.Context) error
 	RecordClick(click model.Clicks) error
 	UpdateCounter(click model.Clicks)
-	GetClickCount(adID string) (int64, error)
-	AdsExists(adID string) (bool, error)
+	GetClickCount(ctx context.Context, adID string) (int64, error)
+	AdsExists(ctx context.Context, adID string) (bool, error)
 	ParseTimeFrame(timeFrame string) (time.Duration, error)
-	GetClickCountByTimeFrame(adID string, timeFrame string) (int64, error)
-	PublishClick(click model.Clicks) error
+	GetClickCountByTimeFrame(ctx context.Context, adID string, timeFrame string) (int64, error)
+	PublishClick(ctx context.Context, click model.Clicks) error
 }
 
 type CounterEntry struct {
@@ -30,16 +30,21 @@ type CounterEntry struct {
 
 type AdsService struct {
 	adsRepo *repo.AdsRepository
+	writer  repo.ClickWriter
 	log     *logger.Logger
 	nats    *NATSService
-	cb      *breaker.CircuitBreaker
+	spool   *ClickSpool
+	cache   *AnalyticsCache
+
+	// Whether clicks NATS won't take are written here instead
+	localFallback bool
+
 	// In-memory counters for better performance
 	counters     map[string]*CounterEntry
 	counterMutex sync.RWMutex
 
 	// Batch processing
-	currentBatch []model.Clicks
-	batchMutex   sync.Mutex
+	batcher *clickBatcher
 
 	// Deduplication tracking
 	processedIDs sync.Map
@@ -1,9 +1,13 @@
 package breaker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
 )
 
 type State int
@@ -14,88 +18,356 @@ const (
 	StateHalfOpen
 )
 
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// Settings configures a CircuitBreaker. Zero values fall back to the defaults below.
+type Settings struct {
+	Name string
+
+	// Window is the sliding time window failure and slow-call rates are
+	// computed over; it is tracked in WindowBuckets equal slices. When
+	// WindowCalls is set the window is the last WindowCalls calls instead,
+	// however old they are.
+	Window        time.Duration
+	WindowBuckets int
+	WindowCalls   int
+
+	// The breaker opens once the window holds at least MinimumRequests calls
+	// and the share of failures reaches FailureRateThreshold (0..1]
+	MinimumRequests      int
+	FailureRateThreshold float64
+
+	// Calls slower than SlowCallThreshold are slow; the breaker also opens
+	// when their share reaches SlowCallRateThreshold. Zero disables either.
+	SlowCallThreshold     time.Duration
+	SlowCallRateThreshold float64
+
+	// OpenTimeout is how long the breaker stays open before letting probes
+	// through. At most HalfOpenMaxCalls probes run concurrently, and that many
+	// must succeed in a row to close the breaker again.
+	OpenTimeout      time.Duration
+	HalfOpenMaxCalls int
+
+	// IsFailure decides which errors count against the breaker. By default
+	// every error does except context cancellation by the caller.
+	IsFailure func(err error) bool
+
+	// OnStateChange, if set, is called after every state transition
+	OnStateChange StateChangeFunc
+}
+
+// StateChangeFunc is notified of a breaker moving from one state to another.
+// It runs outside the breaker's lock, on the goroutine that caused the change.
+type StateChangeFunc func(name string, from, to State)
+
+// Counts are cumulative call outcomes since the breaker was created
+type Counts struct {
+	Requests   uint64 `json:"requests"`
+	Successes  uint64 `json:"successes"`
+	Failures   uint64 `json:"failures"`
+	SlowCalls  uint64 `json:"slow_calls"`
+	Rejections uint64 `json:"rejections"`
+}
+
+// Snapshot is a point-in-time view of a breaker
+type Snapshot struct {
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	Counts   Counts     `json:"counts"`
+
+	// Calls in the current sliding window
+	WindowRequests  int `json:"window_requests"`
+	WindowFailures  int `json:"window_failures"`
+	WindowSlowCalls int `json:"window_slow_calls"`
+}
+
+const (
+	defaultWindow               = time.Minute
+	defaultWindowBuckets        = 10
+	defaultMinimumRequests      = 20
+	defaultFailureRateThreshold = 0.5
+	defaultOpenTimeout          = 10 * time.Second
+	defaultHalfOpenMaxCalls     = 1
+)
+
+func defaultIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
 type CircuitBreaker struct {
-	failureThreshold int
-	resetTimeout     time.Duration
-	state            State
-	failures         int
-	lastFailure      time.Time
-	mutex            sync.RWMutex
-	name             string
+	settings Settings
+	state    State
+	openedAt time.Time
+	window   callWindow
+	mutex    sync.Mutex
+	name     string
+	now      func() time.Time // replaced by tests
+
+	// generation changes on every state transition so calls that started in
+	// an earlier state don't count towards the current one
+	generation        uint64
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+
+	counts      Counts
+	listeners   []StateChangeFunc
+	transitions []transition // queued under the mutex, delivered by unlock
 }
 
-// NewCircuitBreaker creates a new circuit breaker
+type transition struct {
+	from, to State
+}
+
+// NewCircuitBreaker creates a circuit breaker that opens once failureThreshold
+// calls in the last minute have failed at least half the time
 func NewCircuitBreaker(failureThreshold int, resetTimeout time.Duration, name string) *CircuitBreaker {
-	return &CircuitBreaker{
-		failureThreshold: failureThreshold,
-		resetTimeout:     resetTimeout,
-		state:            StateClosed,
-		name:             name,
-	}
+	return NewCircuitBreakerWithSettings(Settings{
+		Name:            name,
+		MinimumRequests: failureThreshold,
+		OpenTimeout:     resetTimeout,
+	})
 }
 
-func (cb *CircuitBreaker) IsOpen() bool {
-	cb.mutex.RLock()
-	// If circuit is open, check if it's time to try again
-	if cb.state == StateOpen {
-		if time.Since(cb.lastFailure) > cb.resetTimeout {
-			// We need to upgrade to write lock
-			cb.mutex.RUnlock()
-			cb.mutex.Lock()
-			defer cb.mutex.Unlock()
-			// Double-check state hasn't changed
-			if cb.state == StateOpen && time.Since(cb.lastFailure) > cb.resetTimeout {
-				cb.state = StateHalfOpen
-				return false
-			}
-			return true
-		}
-		cb.mutex.RUnlock()
-		return true
+// NewCircuitBreakerWithSettings creates a circuit breaker from Settings
+func NewCircuitBreakerWithSettings(s Settings) *CircuitBreaker {
+	if s.Window <= 0 {
+		s.Window = defaultWindow
+	}
+	if s.WindowBuckets <= 0 {
+		s.WindowBuckets = defaultWindowBuckets
 	}
-	cb.mutex.RUnlock()
-	return false
+	if s.MinimumRequests <= 0 {
+		s.MinimumRequests = defaultMinimumRequests
+	}
+	if s.FailureRateThreshold <= 0 || s.FailureRateThreshold > 1 {
+		s.FailureRateThreshold = defaultFailureRateThreshold
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = defaultOpenTimeout
+	}
+	if s.HalfOpenMaxCalls <= 0 {
+		s.HalfOpenMaxCalls = defaultHalfOpenMaxCalls
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = defaultIsFailure
+	}
+
+	cb := &CircuitBreaker{
+		settings: s,
+		state:    StateClosed,
+		name:     s.Name,
+		now:      time.Now,
+	}
+	if s.WindowCalls > 0 {
+		cb.window = newCountWindow(s.WindowCalls)
+	} else {
+		cb.window = newTimeWindow(s.Window, s.WindowBuckets)
+	}
+	if s.OnStateChange != nil {
+		cb.listeners = append(cb.listeners, s.OnStateChange)
+	}
+
+	metrics.SetBreakerState(cb.name, int(StateClosed))
+	return cb
+}
+
+// Name returns the breaker's name
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
 }
 
-func (cb *CircuitBreaker) RecordFailure() {
+// OnStateChange registers fn to be called after every state transition
+func (cb *CircuitBreaker) OnStateChange(fn StateChangeFunc) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
-	cb.failures++
-	cb.lastFailure = time.Now()
+	cb.listeners = append(cb.listeners, fn)
+}
 
-	if cb.state == StateHalfOpen || cb.failures >= cb.failureThreshold {
-		cb.state = StateOpen // Open the circuit
-	}
+// State returns the current state, moving an expired open breaker to half-open
+func (cb *CircuitBreaker) State() State {
+	cb.mutex.Lock()
+	defer cb.unlock()
+	return cb.currentState(cb.now())
 }
 
-func (cb *CircuitBreaker) RecordSuccess() {
+// Snapshot returns the breaker's state and counters
+func (cb *CircuitBreaker) Snapshot() Snapshot {
 	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
-	if cb.state == StateHalfOpen {
-		// Reset circuit after a successful operation in half-open state
-		cb.failures = 0
-		cb.state = StateClosed
-	} else if cb.state == StateClosed && cb.failures > 0 {
-		// Decrease failure count on success
-		cb.failures--
+	defer cb.unlock()
+
+	now := cb.now()
+	state := cb.currentState(now)
+	total, failures, slow := cb.window.totals(now)
+
+	snapshot := Snapshot{
+		Name:            cb.name,
+		State:           state.String(),
+		Counts:          cb.counts,
+		WindowRequests:  total,
+		WindowFailures:  failures,
+		WindowSlowCalls: slow,
 	}
+	if state != StateClosed {
+		openedAt := cb.openedAt
+		snapshot.OpenedAt = &openedAt
+	}
+	return snapshot
+}
+
+func (cb *CircuitBreaker) IsOpen() bool {
+	return cb.State() == StateOpen
 }
 
 // Call executes the given function with circuit breaker protection
 func (cb *CircuitBreaker) Call(fn func() error) error {
-	if cb.IsOpen() {
-		return ErrCircuitBreakerOpen
-	}
-
-	err := fn()
+	generation, err := cb.before()
 	if err != nil {
-		cb.RecordFailure()
 		return err
 	}
 
-	cb.RecordSuccess()
-	return nil
+	start := cb.now()
+	err = fn()
+	cb.after(generation, err, cb.now().Sub(start))
+	return err
+}
+
+// before admits or rejects a call
+func (cb *CircuitBreaker) before() (uint64, error) {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	switch cb.currentState(cb.now()) {
+	case StateOpen:
+		cb.reject()
+		return 0, ErrCircuitBreakerOpen
+	case StateHalfOpen:
+		if cb.halfOpenInFlight >= cb.settings.HalfOpenMaxCalls {
+			cb.reject()
+			return 0, ErrCircuitBreakerOpen
+		}
+		cb.halfOpenInFlight++
+	}
+
+	cb.counts.Requests++
+	return cb.generation, nil
+}
+
+func (cb *CircuitBreaker) reject() {
+	cb.counts.Rejections++
+	metrics.RecordBreakerRejection(cb.name)
+}
+
+// after records the outcome of an admitted call
+func (cb *CircuitBreaker) after(generation uint64, err error, elapsed time.Duration) {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.now()
+	failed := err != nil && cb.settings.IsFailure(err)
+	slow := cb.settings.SlowCallThreshold > 0 && elapsed > cb.settings.SlowCallThreshold
+
+	if failed {
+		cb.counts.Failures++
+	} else {
+		cb.counts.Successes++
+	}
+	if slow {
+		cb.counts.SlowCalls++
+	}
+
+	if generation != cb.generation {
+		return
+	}
+
+	switch cb.state {
+	case StateClosed:
+		cb.window.record(now, failed, slow)
+		if cb.shouldTrip(now) {
+			cb.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		cb.halfOpenInFlight--
+		if failed || slow {
+			cb.setState(StateOpen, now)
+			return
+		}
+		cb.halfOpenSuccesses++
+		if cb.halfOpenSuccesses >= cb.settings.HalfOpenMaxCalls {
+			cb.setState(StateClosed, now)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) shouldTrip(now time.Time) bool {
+	total, failures, slow := cb.window.totals(now)
+	if total < cb.settings.MinimumRequests {
+		return false
+	}
+
+	if float64(failures)/float64(total) >= cb.settings.FailureRateThreshold {
+		return true
+	}
+	return cb.settings.SlowCallRateThreshold > 0 &&
+		float64(slow)/float64(total) >= cb.settings.SlowCallRateThreshold
+}
+
+// currentState must be called with the mutex held
+func (cb *CircuitBreaker) currentState(now time.Time) State {
+	if cb.state == StateOpen && now.Sub(cb.openedAt) >= cb.settings.OpenTimeout {
+		cb.setState(StateHalfOpen, now)
+	}
+	return cb.state
+}
+
+// setState must be called with the mutex held
+func (cb *CircuitBreaker) setState(state State, now time.Time) {
+	if cb.state == state {
+		return
+	}
+
+	cb.transitions = append(cb.transitions, transition{from: cb.state, to: state})
+	metrics.RecordBreakerTransition(cb.name, cb.state.String(), state.String(), int(state))
+
+	cb.state = state
+	cb.generation++
+	cb.halfOpenInFlight = 0
+	cb.halfOpenSuccesses = 0
+
+	switch state {
+	case StateOpen:
+		cb.openedAt = now
+	case StateClosed:
+		cb.window.reset()
+	}
+}
+
+// unlock releases the mutex and then tells listeners about any transitions
+// made while it was held, so they may call back into the breaker
+func (cb *CircuitBreaker) unlock() {
+	transitions := cb.transitions
+	cb.transitions = nil
+	listeners := cb.listeners
+	cb.mutex.Unlock()
+
+	for _, t := range transitions {
+		for _, fn := range listeners {
+			fn(cb.name, t.from, t.to)
+		}
+	}
 }
 
-// ErrCircuitBreakerOpen is returned when the circuit breaker is open
+// ErrCircuitBreakerOpen is returned when the circuit breaker is open, or
+// half-open with all probe slots taken
 var ErrCircuitBreakerOpen = fmt.Errorf("circuit breaker is open")
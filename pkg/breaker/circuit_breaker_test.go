@@ -0,0 +1,289 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+// fakeClock is a manually advanced clock for the breaker and its window
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(s Settings) (*CircuitBreaker, *fakeClock) {
+	s.Name = "test"
+	cb := NewCircuitBreakerWithSettings(s)
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	cb.now = clock.now
+	return cb, clock
+}
+
+// call is one call through the breaker: its outcome and how long it takes
+type call struct {
+	err     error
+	elapsed time.Duration
+}
+
+func ok() call                        { return call{} }
+func fail() call                      { return call{err: errBoom} }
+func slow(elapsed time.Duration) call { return call{elapsed: elapsed} }
+
+func run(cb *CircuitBreaker, clock *fakeClock, calls ...call) {
+	for _, c := range calls {
+		_ = cb.Call(func() error {
+			clock.advance(c.elapsed)
+			return c.err
+		})
+	}
+}
+
+func repeat(c call, n int) []call {
+	calls := make([]call, n)
+	for i := range calls {
+		calls[i] = c
+	}
+	return calls
+}
+
+func TestBreakerTrips(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		calls    []call
+		want     State
+	}{
+		{
+			name:     "below minimum volume",
+			settings: Settings{MinimumRequests: 5},
+			calls:    repeat(fail(), 4),
+			want:     StateClosed,
+		},
+		{
+			name:     "minimum volume reached",
+			settings: Settings{MinimumRequests: 5},
+			calls:    []call{ok(), ok(), fail(), fail(), fail()},
+			want:     StateOpen,
+		},
+		{
+			name:     "failure rate under threshold",
+			settings: Settings{MinimumRequests: 5, FailureRateThreshold: 0.5},
+			calls:    []call{ok(), ok(), ok(), fail(), fail()},
+			want:     StateClosed,
+		},
+		{
+			name:     "failure rate at threshold",
+			settings: Settings{MinimumRequests: 4, FailureRateThreshold: 0.5},
+			calls:    []call{ok(), ok(), fail(), fail()},
+			want:     StateOpen,
+		},
+		{
+			name:     "slow call rate at threshold",
+			settings: Settings{MinimumRequests: 4, SlowCallThreshold: time.Second, SlowCallRateThreshold: 0.5},
+			calls:    []call{ok(), ok(), slow(2 * time.Second), slow(2 * time.Second)},
+			want:     StateOpen,
+		},
+		{
+			name:     "slow call rate disabled",
+			settings: Settings{MinimumRequests: 4, SlowCallThreshold: time.Second},
+			calls:    repeat(slow(2*time.Second), 4),
+			want:     StateClosed,
+		},
+		{
+			name:     "calls at the slow threshold are not slow",
+			settings: Settings{MinimumRequests: 4, SlowCallThreshold: time.Second, SlowCallRateThreshold: 0.5},
+			calls:    repeat(slow(time.Second), 4),
+			want:     StateClosed,
+		},
+		{
+			name:     "failures outside the time window don't count",
+			settings: Settings{MinimumRequests: 4, Window: 10 * time.Second, WindowBuckets: 10},
+			calls:    []call{fail(), fail(), {elapsed: 15 * time.Second}, ok(), ok(), fail()},
+			want:     StateClosed,
+		},
+		{
+			name:     "count window forgets old successes",
+			settings: Settings{MinimumRequests: 4, FailureRateThreshold: 0.6, WindowCalls: 4},
+			calls:    []call{ok(), ok(), ok(), ok(), fail(), fail(), fail()},
+			want:     StateOpen,
+		},
+		{
+			name:     "count window forgets old failures",
+			settings: Settings{MinimumRequests: 4, FailureRateThreshold: 0.6, WindowCalls: 4},
+			calls:    []call{fail(), fail(), ok(), ok(), ok(), ok(), fail(), fail()},
+			want:     StateClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, clock := newTestBreaker(tt.settings)
+			run(cb, clock, tt.calls...)
+			if got := cb.State(); got != tt.want {
+				t.Fatalf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeWindowRotation(t *testing.T) {
+	start := time.Unix(1_000_000, 0)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	tests := []struct {
+		name      string
+		records   []time.Duration
+		totalsAt  time.Duration
+		wantTotal int
+	}{
+		{
+			name:      "all buckets in the window",
+			records:   []time.Duration{0, 5 * time.Second, 9 * time.Second},
+			totalsAt:  9*time.Second + 900*time.Millisecond,
+			wantTotal: 3,
+		},
+		{
+			name:      "oldest bucket rotated out",
+			records:   []time.Duration{0, 5 * time.Second},
+			totalsAt:  10 * time.Second,
+			wantTotal: 1,
+		},
+		{
+			name:      "reused bucket is cleared",
+			records:   []time.Duration{0, 0, 10 * time.Second},
+			totalsAt:  10 * time.Second,
+			wantTotal: 1,
+		},
+		{
+			name:      "whole window expired",
+			records:   []time.Duration{0, time.Second},
+			totalsAt:  30 * time.Second,
+			wantTotal: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTimeWindow(10*time.Second, 10)
+			for _, d := range tt.records {
+				w.record(at(d), true, false)
+			}
+			total, failures, _ := w.totals(at(tt.totalsAt))
+			if total != tt.wantTotal || failures != tt.wantTotal {
+				t.Fatalf("totals = %d/%d, want %d/%d", total, failures, tt.wantTotal, tt.wantTotal)
+			}
+		})
+	}
+}
+
+// halfOpen returns a breaker that has tripped and whose open timeout has run out
+func halfOpen(t *testing.T, maxCalls int) (*CircuitBreaker, *fakeClock) {
+	t.Helper()
+	cb, clock := newTestBreaker(Settings{
+		MinimumRequests:   1,
+		OpenTimeout:       10 * time.Second,
+		HalfOpenMaxCalls:  maxCalls,
+		SlowCallThreshold: time.Second,
+	})
+	run(cb, clock, fail())
+	if got := cb.State(); got != StateOpen {
+		t.Fatalf("state = %s, want open", got)
+	}
+	if err := cb.Call(func() error { return nil }); !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Fatalf("call while open = %v, want %v", err, ErrCircuitBreakerOpen)
+	}
+
+	clock.advance(10 * time.Second)
+	if got := cb.State(); got != StateHalfOpen {
+		t.Fatalf("state = %s, want half-open", got)
+	}
+	return cb, clock
+}
+
+func TestHalfOpenProbes(t *testing.T) {
+	tests := []struct {
+		name   string
+		probes []call
+		want   State
+	}{
+		{name: "all probes succeed", probes: []call{ok(), ok()}, want: StateClosed},
+		{name: "too few probes so far", probes: []call{ok()}, want: StateHalfOpen},
+		{name: "a probe fails", probes: []call{ok(), fail()}, want: StateOpen},
+		{name: "a probe is slow", probes: []call{slow(2 * time.Second), ok()}, want: StateOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, clock := halfOpen(t, 2)
+
+			dones := make([]func(error), 0, len(tt.probes))
+			for range tt.probes {
+				done, err := cb.Allow()
+				if err != nil {
+					t.Fatalf("probe rejected: %v", err)
+				}
+				dones = append(dones, done)
+			}
+			for i, probe := range tt.probes {
+				clock.advance(probe.elapsed)
+				dones[i](probe.err)
+			}
+
+			if got := cb.State(); got != tt.want {
+				t.Fatalf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHalfOpenCapsConcurrentProbes(t *testing.T) {
+	cb, _ := halfOpen(t, 2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cb.Allow(); err != nil {
+			t.Fatalf("probe %d rejected: %v", i+1, err)
+		}
+	}
+	if _, err := cb.Allow(); !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Fatalf("third probe = %v, want %v", err, ErrCircuitBreakerOpen)
+	}
+	if got := cb.Snapshot().Counts.Rejections; got != 2 {
+		t.Fatalf("rejections = %d, want 2", got)
+	}
+}
+
+func TestAllowDoneRecordsOnce(t *testing.T) {
+	cb, _ := halfOpen(t, 2)
+
+	first, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if _, err := cb.Allow(); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+
+	// A second done must neither count as another success nor free the
+	// other probe's slot
+	first(nil)
+	first(nil)
+
+	if got := cb.State(); got != StateHalfOpen {
+		t.Fatalf("state = %s, want half-open", got)
+	}
+	if _, err := cb.Allow(); err != nil {
+		t.Fatalf("freed slot rejected: %v", err)
+	}
+	if _, err := cb.Allow(); !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Fatalf("probe over the cap = %v, want %v", err, ErrCircuitBreakerOpen)
+	}
+	if got := cb.Snapshot().Counts.Successes; got != 1 {
+		t.Fatalf("successes = %d, want 1", got)
+	}
+}
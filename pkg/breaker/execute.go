@@ -0,0 +1,75 @@
+package breaker
+
+import (
+	"context"
+	"sync"
+)
+
+// Execute runs fn under the breaker and returns its result. It gives up as
+// soon as ctx is done, returning ctx.Err(); fn gets the same ctx and should
+// stop too, and its outcome is still recorded when it returns. A caller's own
+// cancellation doesn't count as a failure unless IsFailure says otherwise,
+// while a missed deadline does. A nil breaker runs fn unguarded.
+//
+// Because Execute can return before fn does, anything held for fn's sake,
+// such as a bulkhead slot, has to be released by fn, not by the caller.
+func Execute[T any](ctx context.Context, cb *CircuitBreaker, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	if cb == nil {
+		return fn(ctx)
+	}
+
+	generation, err := cb.before()
+	if err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	start := cb.now()
+
+	go func() {
+		value, err := fn(ctx)
+		cb.after(generation, err, cb.now().Sub(start))
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// CallContext is Execute for functions that only return an error
+func (cb *CircuitBreaker) CallContext(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := Execute(ctx, cb, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Allow admits a single call for callers that can't wrap it in a function,
+// such as client hooks. done must be called with the outcome; only the first
+// call is recorded, so a hook firing twice can't free a second probe slot.
+func (cb *CircuitBreaker) Allow() (done func(err error), err error) {
+	generation, err := cb.before()
+	if err != nil {
+		return nil, err
+	}
+
+	start := cb.now()
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			cb.after(generation, err, cb.now().Sub(start))
+		})
+	}, nil
+}
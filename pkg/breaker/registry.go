@@ -0,0 +1,84 @@
+package breaker
+
+import (
+	"sort"
+	"sync"
+)
+
+// Option adjusts the settings of a breaker created through a Registry
+type Option func(*Settings)
+
+// WithIsFailure overrides which errors count against the breaker
+func WithIsFailure(fn func(err error) bool) Option {
+	return func(s *Settings) {
+		s.IsFailure = fn
+	}
+}
+
+// Registry hands out one circuit breaker per dependency, so an outage of one
+// (say Postgres) doesn't reject calls to the others
+type Registry struct {
+	mutex    sync.RWMutex
+	defaults Settings
+	breakers map[string]*CircuitBreaker
+}
+
+// NewRegistry creates an empty registry whose breakers start from defaults
+func NewRegistry(defaults Settings) *Registry {
+	return &Registry{
+		defaults: defaults,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// Get returns the breaker for name, creating it from the registry defaults
+// and opts on first use. Options are ignored once the breaker exists.
+func (r *Registry) Get(name string, opts ...Option) *CircuitBreaker {
+	r.mutex.RLock()
+	cb, ok := r.breakers[name]
+	r.mutex.RUnlock()
+	if ok {
+		return cb
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if cb, ok := r.breakers[name]; ok {
+		return cb
+	}
+
+	settings := r.defaults
+	settings.Name = name
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	cb = NewCircuitBreakerWithSettings(settings)
+	r.breakers[name] = cb
+	return cb
+}
+
+// Register adds a breaker, replacing any previous one with the same name
+func (r *Registry) Register(cb *CircuitBreaker) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.breakers[cb.Name()] = cb
+}
+
+// Snapshots returns the state of every registered breaker, sorted by name
+func (r *Registry) Snapshots() []Snapshot {
+	r.mutex.RLock()
+	breakers := make([]*CircuitBreaker, 0, len(r.breakers))
+	for _, cb := range r.breakers {
+		breakers = append(breakers, cb)
+	}
+	r.mutex.RUnlock()
+
+	snapshots := make([]Snapshot, 0, len(breakers))
+	for _, cb := range breakers {
+		snapshots = append(snapshots, cb.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots
+}
@@ -0,0 +1,119 @@
+package breaker
+
+import "time"
+
+// callWindow holds the recent call outcomes the trip decision is made on
+type callWindow interface {
+	record(now time.Time, failed, slow bool)
+	totals(now time.Time) (total, failures, slow int)
+	reset()
+}
+
+// timeWindow counts calls over a sliding time window made of fixed-width
+// buckets. Buckets are reused in a ring and cleared lazily when their slot
+// comes round again.
+type timeWindow struct {
+	buckets []bucket
+	width   time.Duration
+}
+
+type bucket struct {
+	slot     int64 // which bucket-width interval since the epoch this holds
+	total    int
+	failures int
+	slow     int
+}
+
+func newTimeWindow(size time.Duration, buckets int) *timeWindow {
+	return &timeWindow{
+		buckets: make([]bucket, buckets),
+		width:   max(size/time.Duration(buckets), time.Millisecond),
+	}
+}
+
+func (w *timeWindow) record(now time.Time, failed, slow bool) {
+	slot := now.UnixNano() / int64(w.width)
+	b := &w.buckets[slot%int64(len(w.buckets))]
+	if b.slot != slot {
+		*b = bucket{slot: slot}
+	}
+
+	b.total++
+	if failed {
+		b.failures++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+func (w *timeWindow) totals(now time.Time) (total, failures, slow int) {
+	current := now.UnixNano() / int64(w.width)
+	oldest := current - int64(len(w.buckets)) + 1
+
+	for _, b := range w.buckets {
+		if b.slot < oldest || b.slot > current {
+			continue
+		}
+		total += b.total
+		failures += b.failures
+		slow += b.slow
+	}
+	return total, failures, slow
+}
+
+func (w *timeWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
+
+// countWindow keeps the outcomes of the last len(calls) calls in a ring, with
+// running totals so neither record nor totals has to walk it
+type countWindow struct {
+	calls    []outcome
+	next     int
+	total    int
+	failures int
+	slow     int
+}
+
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+func newCountWindow(size int) *countWindow {
+	return &countWindow{calls: make([]outcome, size)}
+}
+
+func (w *countWindow) record(_ time.Time, failed, slow bool) {
+	if w.total == len(w.calls) {
+		evicted := w.calls[w.next]
+		if evicted.failed {
+			w.failures--
+		}
+		if evicted.slow {
+			w.slow--
+		}
+	} else {
+		w.total++
+	}
+
+	w.calls[w.next] = outcome{failed: failed, slow: slow}
+	w.next = (w.next + 1) % len(w.calls)
+	if failed {
+		w.failures++
+	}
+	if slow {
+		w.slow++
+	}
+}
+
+func (w *countWindow) totals(time.Time) (total, failures, slow int) {
+	return w.total, w.failures, w.slow
+}
+
+func (w *countWindow) reset() {
+	*w = countWindow{calls: make([]outcome, len(w.calls))}
+}
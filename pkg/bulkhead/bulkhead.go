@@ -0,0 +1,102 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+// ErrBulkheadFull is returned when no slot frees up within the queueing timeout
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// Bulkhead caps how many calls of one kind run at once, so a burst of one
+// workload (say analytics) can't use up resources another (click ingestion)
+// depends on. Calls beyond the cap queue for at most maxWait.
+type Bulkhead struct {
+	name    string
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+// New creates a bulkhead admitting maxConcurrent calls at a time. A call
+// waits up to maxWait for a slot; zero means it is rejected straight away.
+func New(name string, maxConcurrent int, maxWait time.Duration) *Bulkhead {
+	metrics.UpdateBulkheadInFlight(name, 0)
+	return &Bulkhead{
+		name:    name,
+		slots:   make(chan struct{}, max(maxConcurrent, 1)),
+		maxWait: maxWait,
+	}
+}
+
+// Name returns the bulkhead's name
+func (b *Bulkhead) Name() string {
+	return b.name
+}
+
+// Acquire takes a slot, waiting until one frees up, maxWait passes or ctx is
+// done. The returned func gives the slot back and must be called exactly once.
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case b.slots <- struct{}{}:
+		metrics.UpdateBulkheadInFlight(b.name, len(b.slots))
+		return b.release, nil
+	default:
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.RecordBulkheadWait(b.name, time.Since(start).Seconds())
+	}()
+
+	if b.maxWait <= 0 {
+		metrics.RecordBulkheadRejection(b.name)
+		return nil, ErrBulkheadFull
+	}
+
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		metrics.UpdateBulkheadInFlight(b.name, len(b.slots))
+		return b.release, nil
+	case <-timer.C:
+		metrics.RecordBulkheadRejection(b.name)
+		return nil, ErrBulkheadFull
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *Bulkhead) release() {
+	<-b.slots
+	metrics.UpdateBulkheadInFlight(b.name, len(b.slots))
+}
+
+// Do runs fn while holding a slot. A nil bulkhead runs fn unbounded.
+func (b *Bulkhead) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if b == nil {
+		return fn(ctx)
+	}
+
+	release, err := b.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return fn(ctx)
+}
+
+// InFlight returns the number of slots currently taken
+func (b *Bulkhead) InFlight() int {
+	return len(b.slots)
+}
+
+// Capacity returns the maximum number of concurrent calls
+func (b *Bulkhead) Capacity() int {
+	return cap(b.slots)
+}
@@ -0,0 +1,187 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ratheeshkumar25/adsmetrictracker/pkg/metrics"
+)
+
+// Check statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Report statuses
+const (
+	StatusReady    = "ready"     // every check passed
+	StatusDegraded = "degraded"  // only non-critical checks failed
+	StatusNotReady = "not_ready" // a critical check failed, or the service is draining
+)
+
+// ErrDraining is reported while the service shuts down
+var ErrDraining = errors.New("service is shutting down")
+
+// Check is a single named health check
+type Check struct {
+	Name string
+
+	// Critical checks fail the whole report; others only degrade it
+	Critical bool
+
+	// Timeout overrides the checker's default timeout for this check
+	Timeout time.Duration
+
+	Fn func(ctx context.Context) error
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Critical   bool    `json:"critical"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the outcome of every registered check
+type Report struct {
+	Status    string    `json:"status"`
+	Checks    []Result  `json:"checks"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// OK reports whether the service should be considered healthy
+func (r *Report) OK() bool {
+	return r.Status != StatusNotReady
+}
+
+// Checker runs registered checks concurrently, each under its own timeout,
+// and caches the report for cacheTTL so frequent probes from several sources
+// don't hammer the dependencies being checked
+type Checker struct {
+	name     string
+	timeout  time.Duration
+	cacheTTL time.Duration
+	draining atomic.Bool
+
+	mu       sync.Mutex // held while checks run, so concurrent probes share a run
+	checks   []Check
+	cached   *Report
+	cachedAt time.Time
+}
+
+// NewChecker creates a checker with no checks; name labels its metrics
+func NewChecker(name string, timeout, cacheTTL time.Duration) *Checker {
+	return &Checker{
+		name:     name,
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Register adds a check
+func (c *Checker) Register(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+	c.cached = nil
+}
+
+// Drain makes every later report not ready without running the checks, so
+// load balancers stop routing to the service before it shuts down
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Run returns the current report, running the checks if the cached one has expired
+func (c *Checker) Run(ctx context.Context) *Report {
+	if c.draining.Load() {
+		return &Report{
+			Status:    StatusNotReady,
+			Checks:    []Result{{Name: "draining", Status: StatusDown, Critical: true, Error: ErrDraining.Error()}},
+			CheckedAt: time.Now(),
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && time.Since(c.cachedAt) < c.cacheTTL {
+		return c.cached
+	}
+
+	report := &Report{
+		Status:    StatusReady,
+		Checks:    make([]Result, len(c.checks)),
+		CheckedAt: time.Now(),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusNotReady
+		} else if report.Status == StatusReady {
+			report.Status = StatusDegraded
+		}
+	}
+
+	c.cached, c.cachedAt = report, time.Now()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = c.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// A check that ignores its context still can't hold up the report
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		done <- check.Fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Name:       check.Name,
+		Status:     StatusUp,
+		Critical:   check.Critical,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	metrics.SetHealthCheck(c.name, check.Name, err == nil)
+	return result
+}
@@ -0,0 +1,34 @@
+package logger
+
+import "context"
+
+// Field names identifying a request or click in log entries; grep one value
+// to follow it across the API, NATS and consumers on every replica
+const (
+	FieldRequestID = "request_id"
+	FieldClickID   = "click_id"
+	FieldAdID      = "ad_id"
+)
+
+type loggerKey struct{}
+
+// With returns a logger adding keysAndValues to every entry it writes. The
+// fields are only encoded when an entry is, so a per-click logger costs
+// next to nothing while its entries are below the level.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	return &Logger{Logger: l.Logger.WithLazy(keysAndValues...), level: l.level}
+}
+
+// NewContext returns ctx carrying l, so code further down the call chain logs
+// with the same fields
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger ctx carries, or fallback if it carries none
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return fallback
+}
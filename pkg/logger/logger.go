@@ -2,6 +2,8 @@ package logger
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/ratheeshkumar25/adsmetrictracker/config"
 	"go.uber.org/zap"
@@ -11,34 +13,70 @@ import (
 
 type Logger struct {
 	Logger *zap.SugaredLogger
+
+	// Shared by every logger derived with With, so SetLevel applies to all
+	level zap.AtomicLevel
 }
 
-// NewProductionZapLogger will return a new production logger backed by zap
+// NewLogger builds the service logger from the LOG_* settings: level,
+// stdout and/or a size-rotated file, JSON or console encoding, and sampling
 func NewLogger(cfg *config.Config) (*Logger, error) {
-	conf := zap.NewProductionConfig()
-	conf.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	conf.DisableCaller = true
-	conf.DisableStacktrace = true
-	fmt.Println(cfg.LogFile)
-
-	//zapLogger, err := conf.Build(zap.WrapCore(zapCore))
-	zapLogger, err := conf.Build(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
-		w := zapcore.AddSync(&lumberjack.Logger{
+	level, err := zap.ParseAtomicLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	encoderCfg := zap.NewProductionEncoderConfig()
+	var encoder zapcore.Encoder
+	if cfg.LogEncoding == config.LogEncodingConsole {
+		encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	}
+
+	var sinks []zapcore.WriteSyncer
+	if cfg.LogOutput != config.LogOutputFile {
+		sinks = append(sinks, zapcore.Lock(os.Stdout))
+	}
+	if cfg.LogOutput != config.LogOutputStdout {
+		sinks = append(sinks, zapcore.AddSync(&lumberjack.Logger{
 			Filename:   cfg.LogFile,
-			MaxSize:    1, // megabytes
-			MaxBackups: 30,
-			MaxAge:     30, // days
-		})
-		core := zapcore.NewCore(
-			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
-			w,
-			zap.DebugLevel,
-		)
-		cores := zapcore.NewTee(c, core)
-		return cores
-
-	}))
+			MaxSize:    cfg.LogMaxSizeMB,
+			MaxBackups: cfg.LogMaxBackups,
+			MaxAge:     cfg.LogMaxAgeDays,
+		}))
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(sinks...), level)
+
+	// Per second, log the first LOG_SAMPLING_INITIAL entries with the same
+	// level and message, then every LOG_SAMPLING_THEREAFTER-th
+	if cfg.LogSamplingInitial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.LogSamplingInitial, cfg.LogSamplingThereafter)
+	}
+
 	return &Logger{
-		Logger: zapLogger.Sugar(),
-	}, err
+		Logger: zap.New(core).Sugar(),
+		level:  level,
+	}, nil
+}
+
+// Level returns the minimum level being logged
+func (l *Logger) Level() zapcore.Level {
+	return l.level.Level()
+}
+
+// SetLevel changes the minimum level logged, for this logger and every
+// logger derived from it, without a restart
+func (l *Logger) SetLevel(level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if lvl < zapcore.DebugLevel || lvl > zapcore.ErrorLevel {
+		return fmt.Errorf("log level must be debug, info, warn or error, not %q", level)
+	}
+	l.level.SetLevel(lvl)
+	return nil
 }
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AdLabelOther is the ad_id label shared by ads without a series of their own
+const AdLabelOther = "other"
+
+// adLabels bounds the ad_id label. Allowlisted ads always get their own
+// series, and so do the topK ads with the most recent clicks. Click counts
+// halve at every re-rank, so the ranking follows current traffic; an ad that
+// drops out of the top has its series deleted and is counted under "other".
+type adLabels struct {
+	mu      sync.Mutex
+	allow   map[string]struct{}
+	topK    int
+	refresh time.Duration
+
+	counts   map[string]int64
+	top      map[string]struct{}
+	rerankAt time.Time
+}
+
+// LimitAdLabels caps ad_id series to the allowlisted ads plus the topK busiest
+// others, re-ranked every refresh. Call it before any click is recorded.
+func (r *Registry) LimitAdLabels(topK int, allowlist []string, refresh time.Duration) {
+	allow := make(map[string]struct{}, len(allowlist))
+	for _, adID := range allowlist {
+		allow[adID] = struct{}{}
+	}
+	r.adLabels = &adLabels{
+		allow:   allow,
+		topK:    topK,
+		refresh: refresh,
+		counts:  make(map[string]int64),
+		top:     make(map[string]struct{}, topK),
+	}
+}
+
+// inc counts a click on adID in counter under its ad_id label. Evicted series
+// are deleted and the counter bumped under the same lock as the ranking;
+// otherwise a click labelled just before a re-rank could recreate a series
+// right after it was deleted.
+func (l *adLabels) inc(counter *prometheus.CounterVec, adID string, now time.Time) {
+	if _, ok := l.allow[adID]; ok {
+		counter.WithLabelValues(adID).Inc()
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	label, evicted := l.label(adID, now)
+	for _, id := range evicted {
+		counter.DeleteLabelValues(id)
+	}
+	counter.WithLabelValues(label).Inc()
+}
+
+// label returns the ad_id label for a click on adID, plus the ads whose
+// series should be deleted because a re-rank pushed them out of the top.
+// l.mu must be held.
+func (l *adLabels) label(adID string, now time.Time) (label string, evicted []string) {
+	if l.rerankAt.IsZero() {
+		l.rerankAt = now.Add(l.refresh)
+	}
+	if !now.Before(l.rerankAt) {
+		evicted = l.rerank()
+		l.rerankAt = now.Add(l.refresh)
+	}
+
+	l.counts[adID]++
+
+	// Until the top is full, ads get a series as they show up
+	if _, ok := l.top[adID]; !ok && len(l.top) < l.topK {
+		l.top[adID] = struct{}{}
+	}
+	if _, ok := l.top[adID]; ok {
+		return adID, evicted
+	}
+	return AdLabelOther, evicted
+}
+
+// rerank makes the topK highest counts the new top and halves every count
+func (l *adLabels) rerank() (evicted []string) {
+	ranked := make([]string, 0, len(l.counts))
+	for adID := range l.counts {
+		ranked = append(ranked, adID)
+	}
+	sort.Slice(ranked, func(i, j int) bool { return l.counts[ranked[i]] > l.counts[ranked[j]] })
+	if len(ranked) > l.topK {
+		ranked = ranked[:l.topK]
+	}
+
+	top := make(map[string]struct{}, l.topK)
+	for _, adID := range ranked {
+		top[adID] = struct{}{}
+	}
+	for adID := range l.top {
+		if _, ok := top[adID]; !ok {
+			evicted = append(evicted, adID)
+		}
+	}
+	l.top = top
+
+	for adID, n := range l.counts {
+		if n /= 2; n == 0 {
+			delete(l.counts, adID)
+		} else {
+			l.counts[adID] = n
+		}
+	}
+	return evicted
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clickSeries returns the ad_clicks_total value of every ad_id series
+func clickSeries(t *testing.T, r *Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := r.Gatherer().Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+
+	series := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "ad_clicks_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "ad_id" {
+					series[label.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return series
+}
+
+func assertSeries(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("series = %v, want %v", got, want)
+	}
+	for label, value := range want {
+		if got[label] != value {
+			t.Fatalf("series = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAdLabelsTopKAndOther(t *testing.T) {
+	r := NewRegistry()
+	r.LimitAdLabels(2, []string{"vip"}, time.Minute)
+	start := time.Now()
+
+	click := func(adID string, n int, at time.Time) {
+		for i := 0; i < n; i++ {
+			r.adLabels.inc(r.ClickTotal, adID, at)
+		}
+	}
+
+	// The first two ads fill the top; later ones share "other", while
+	// allowlisted ads always get their own series
+	click("a", 1, start)
+	click("b", 2, start)
+	click("c", 6, start)
+	click("vip", 3, start)
+
+	assertSeries(t, clickSeries(t, r), map[string]float64{
+		"a":          1,
+		"b":          2,
+		AdLabelOther: 6,
+		"vip":        3,
+	})
+}
+
+func TestAdLabelsRerankEvicts(t *testing.T) {
+	r := NewRegistry()
+	r.LimitAdLabels(2, nil, time.Minute)
+	start := time.Now()
+
+	click := func(adID string, n int, at time.Time) {
+		for i := 0; i < n; i++ {
+			r.adLabels.inc(r.ClickTotal, adID, at)
+		}
+	}
+
+	click("a", 1, start)
+	click("b", 2, start)
+	click("c", 6, start)
+
+	// The re-rank makes c and b the top; a's series is deleted and its
+	// clicks from now on go to "other"
+	click("c", 1, start.Add(time.Minute))
+	click("a", 1, start.Add(time.Minute))
+
+	assertSeries(t, clickSeries(t, r), map[string]float64{
+		"b":          2,
+		"c":          1,
+		AdLabelOther: 7,
+	})
+}
+
+// Concurrent clicks across constant re-ranks must never leave a series behind
+// for an ad outside the top
+func TestAdLabelsConcurrentEviction(t *testing.T) {
+	r := NewRegistry()
+	r.LimitAdLabels(3, nil, time.Microsecond)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				r.RecordClick(fmt.Sprintf("ad-%d", (w*7+i)%20), 0)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	r.adLabels.mu.Lock()
+	defer r.adLabels.mu.Unlock()
+	for label := range clickSeries(t, r) {
+		if _, ok := r.adLabels.top[label]; !ok && label != AdLabelOther {
+			t.Errorf("series for %q outlived its eviction", label)
+		}
+	}
+}
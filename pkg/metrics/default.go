@@ -0,0 +1,131 @@
+package metrics
+
+import "time"
+
+// The functions below record to the default registry
+
+// RecordHTTPRequest records HTTP request metrics
+func RecordHTTPRequest(method, endpoint, statusCode string, duration float64) {
+	defaultRegistry.RecordHTTPRequest(method, endpoint, statusCode, duration)
+}
+
+// RecordClick records ad click metrics
+func RecordClick(adID string, duration float64) {
+	defaultRegistry.RecordClick(adID, duration)
+}
+
+// RecordDatabaseOperation records database operation metrics
+func RecordDatabaseOperation(operation, status string, duration float64) {
+	defaultRegistry.RecordDatabaseOperation(operation, status, duration)
+}
+
+// RecordRedisOperation records Redis operation metrics
+func RecordRedisOperation(operation, status string, duration float64) {
+	defaultRegistry.RecordRedisOperation(operation, status, duration)
+}
+
+// RecordError records error metrics
+func RecordError(errorType, component string) {
+	defaultRegistry.RecordError(errorType, component)
+}
+
+// UpdateQueueSize updates queue size metrics
+func UpdateQueueSize(queueName string, size float64) {
+	defaultRegistry.UpdateQueueSize(queueName, size)
+}
+
+// RecordQueueProcessing records queue processing metrics
+func RecordQueueProcessing(queueName string, duration float64) {
+	defaultRegistry.RecordQueueProcessing(queueName, duration)
+}
+
+// RecordClickDrift records the outcome of a click counter reconciliation
+func RecordClickDrift(driftedAds int, totalDrift int64) {
+	defaultRegistry.RecordClickDrift(driftedAds, totalDrift)
+}
+
+// RecordBatch records the size and age of a flushed click batch
+func RecordBatch(size int, age float64) {
+	defaultRegistry.RecordBatch(size, age)
+}
+
+// UpdateBatchTargets records the adaptive batcher's current thresholds
+func UpdateBatchTargets(size int, latency float64) {
+	defaultRegistry.UpdateBatchTargets(size, latency)
+}
+
+// RecordBatchRetry records a retry of a failed click batch
+func RecordBatchRetry() {
+	defaultRegistry.RecordBatchRetry()
+}
+
+// RecordQuarantinedClicks records clicks set aside after a permanent write failure
+func RecordQuarantinedClicks(n int) {
+	defaultRegistry.RecordQuarantinedClicks(n)
+}
+
+// SetBreakerState records a circuit breaker's current state
+func SetBreakerState(name string, state int) {
+	defaultRegistry.SetBreakerState(name, state)
+}
+
+// RecordBreakerRejection records a call rejected by a circuit breaker
+func RecordBreakerRejection(name string) {
+	defaultRegistry.RecordBreakerRejection(name)
+}
+
+// RecordBreakerTransition records a circuit breaker changing state
+func RecordBreakerTransition(name, from, to string, state int) {
+	defaultRegistry.RecordBreakerTransition(name, from, to, state)
+}
+
+// RecordSpooled records clicks written to the disk spool
+func RecordSpooled(n int, backlog int64) {
+	defaultRegistry.RecordSpooled(n, backlog)
+}
+
+// RecordDrained records clicks taken back from the disk spool
+func RecordDrained(n int, backlog int64) {
+	defaultRegistry.RecordDrained(n, backlog)
+}
+
+// UpdateSpoolBacklog records how many clicks the disk spool holds
+func UpdateSpoolBacklog(backlog int64) {
+	defaultRegistry.UpdateSpoolBacklog(backlog)
+}
+
+// RecordStaleAnalytics records an analytics response served from cache
+func RecordStaleAnalytics() {
+	defaultRegistry.RecordStaleAnalytics()
+}
+
+// UpdateBulkheadInFlight records how many slots of a bulkhead are taken
+func UpdateBulkheadInFlight(name string, inFlight int) {
+	defaultRegistry.UpdateBulkheadInFlight(name, inFlight)
+}
+
+// RecordBulkheadWait records the time a call queued for a bulkhead slot
+func RecordBulkheadWait(name string, wait float64) {
+	defaultRegistry.RecordBulkheadWait(name, wait)
+}
+
+// RecordBulkheadRejection records a call that timed out waiting for a slot
+func RecordBulkheadRejection(name string) {
+	defaultRegistry.RecordBulkheadRejection(name)
+}
+
+// SetHealthCheck records the outcome of a health check
+func SetHealthCheck(probe, check string, up bool) {
+	defaultRegistry.SetHealthCheck(probe, check, up)
+}
+
+// RecordClickStageLatency records the time a click took between two pipeline
+// stages, also feeding the recent maximum reported by StageLags
+func RecordClickStageLatency(stage string, latency time.Duration) {
+	defaultRegistry.RecordClickStageLatency(stage, latency)
+}
+
+// StageLags returns the recent latency of every pipeline stage seen so far
+func StageLags() []StageLag {
+	return defaultRegistry.StageLags()
+}
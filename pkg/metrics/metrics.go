@@ -1,147 +1,527 @@
 package metrics
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var (
+// Registry holds the service's collectors, registered with one Prometheus
+// registerer. The package-level functions record to the default registry,
+// which is served on /metrics; tests build their own with NewRegistry so they
+// don't share counters.
+type Registry struct {
+	registerer prometheus.Registerer
+	gatherer   prometheus.Gatherer
+
+	// Which ad IDs get their own ad_id series; nil labels every ad
+	adLabels *adLabels
+
+	// Recent per-stage click latency, for StageLags
+	stageLags *stageLagTracker
+
 	// HTTP request metrics
-	RequestTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status_code"},
-	)
-
-	RequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "http_request_duration_seconds",
-			Help: "Duration of HTTP requests",
-		},
-		[]string{"method", "endpoint"},
-	)
+	RequestTotal    *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
 
 	// Ad click metrics
-	ClickTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "ad_clicks_total",
-			Help: "Total number of ad clicks",
-		},
-		[]string{"ad_id"},
-	)
-
-	ClickProcessingDuration = promauto.NewHistogram(
-		prometheus.HistogramOpts{
-			Name: "click_processing_duration_seconds",
-			Help: "Duration of click processing",
-		},
-	)
+	ClickTotal              *prometheus.CounterVec
+	ClickProcessingDuration prometheus.Histogram
 
 	// Database metrics
-	DatabaseOperationTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "database_operations_total",
-			Help: "Total number of database operations",
-		},
-		[]string{"operation", "status"},
-	)
-
-	DatabaseOperationDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "database_operation_duration_seconds",
-			Help: "Duration of database operations",
-		},
-		[]string{"operation"},
-	)
+	DatabaseOperationTotal    *prometheus.CounterVec
+	DatabaseOperationDuration *prometheus.HistogramVec
 
 	// Redis metrics
-	RedisOperationTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "redis_operations_total",
-			Help: "Total number of Redis operations",
-		},
-		[]string{"operation", "status"},
-	)
-
-	RedisOperationDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "redis_operation_duration_seconds",
-			Help: "Duration of Redis operations",
-		},
-		[]string{"operation"},
-	)
+	RedisOperationTotal    *prometheus.CounterVec
+	RedisOperationDuration *prometheus.HistogramVec
 
 	// Queue metrics
-	QueueSize = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "queue_size",
-			Help: "Current size of processing queues",
-		},
-		[]string{"queue_name"},
-	)
-
-	QueueProcessingDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "queue_processing_duration_seconds",
-			Help: "Duration of queue processing",
-		},
-		[]string{"queue_name"},
-	)
+	QueueSize               *prometheus.GaugeVec
+	QueueProcessingDuration *prometheus.HistogramVec
+
+	// Click batching metrics
+	BatchSize          prometheus.Histogram
+	BatchAge           prometheus.Histogram
+	BatchTargetSize    prometheus.Gauge
+	BatchTargetLatency prometheus.Gauge
+	BatchRetries       prometheus.Counter
+	ClicksQuarantined  prometheus.Counter
+
+	// Fallback metrics
+	ClicksSpooled  prometheus.Counter
+	ClicksDrained  prometheus.Counter
+	SpoolBacklog   prometheus.Gauge
+	StaleAnalytics prometheus.Counter
+
+	// Circuit breaker metrics
+	BreakerState       *prometheus.GaugeVec
+	BreakerRejections  *prometheus.CounterVec
+	BreakerTransitions *prometheus.CounterVec
+
+	// Bulkhead metrics
+	BulkheadInFlight   *prometheus.GaugeVec
+	BulkheadRejections *prometheus.CounterVec
+	BulkheadWait       *prometheus.HistogramVec
+
+	// Health check metrics
+	HealthCheckUp *prometheus.GaugeVec
+
+	// End-to-end click latency metrics
+	ClickStageLatency *prometheus.HistogramVec
+
+	// Reconciliation metrics
+	ClickCounterDrift      prometheus.Gauge
+	ClickCounterDriftedAds prometheus.Gauge
 
 	// System metrics
-	ActiveConnections = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "active_connections",
-			Help: "Number of active connections",
-		},
-	)
-
-	ErrorTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "errors_total",
-			Help: "Total number of errors",
-		},
-		[]string{"error_type", "component"},
-	)
-)
+	ActiveConnections prometheus.Gauge
+	ErrorTotal        *prometheus.CounterVec
+}
+
+var defaultRegistry = newRegistry(prometheus.DefaultRegisterer, prometheus.DefaultGatherer)
+
+// Default returns the registry the package-level functions record to
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// NewRegistry creates a registry with its own, empty Prometheus registry
+func NewRegistry() *Registry {
+	reg := prometheus.NewRegistry()
+	return newRegistry(reg, reg)
+}
+
+func newRegistry(registerer prometheus.Registerer, gatherer prometheus.Gatherer) *Registry {
+	factory := promauto.With(registerer)
+	return &Registry{
+		registerer: registerer,
+		gatherer:   gatherer,
+		stageLags:  newStageLagTracker(),
+
+		// HTTP request metrics
+		RequestTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_requests_total",
+				Help: "Total number of HTTP requests",
+			},
+			[]string{"method", "endpoint", "status_code"},
+		),
+
+		RequestDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "http_request_duration_seconds",
+				Help: "Duration of HTTP requests",
+			},
+			[]string{"method", "endpoint"},
+		),
+
+		// Ad click metrics
+		ClickTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ad_clicks_total",
+				Help: "Total number of ad clicks",
+			},
+			[]string{"ad_id"},
+		),
+
+		ClickProcessingDuration: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Name: "click_processing_duration_seconds",
+				Help: "Duration of click processing",
+			},
+		),
+
+		// Database metrics
+		DatabaseOperationTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "database_operations_total",
+				Help: "Total number of database operations",
+			},
+			[]string{"operation", "status"},
+		),
+
+		DatabaseOperationDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "database_operation_duration_seconds",
+				Help: "Duration of database operations",
+			},
+			[]string{"operation"},
+		),
+
+		// Redis metrics
+		RedisOperationTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "redis_operations_total",
+				Help: "Total number of Redis operations",
+			},
+			[]string{"operation", "status"},
+		),
+
+		RedisOperationDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "redis_operation_duration_seconds",
+				Help: "Duration of Redis operations",
+			},
+			[]string{"operation"},
+		),
+
+		// Queue metrics
+		QueueSize: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "queue_size",
+				Help: "Current size of processing queues",
+			},
+			[]string{"queue_name"},
+		),
+
+		QueueProcessingDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "queue_processing_duration_seconds",
+				Help: "Duration of queue processing",
+			},
+			[]string{"queue_name"},
+		),
+
+		// Click batching metrics
+		BatchSize: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "click_batch_size",
+				Help:    "Number of clicks per flushed batch",
+				Buckets: prometheus.ExponentialBuckets(1, 2, 14), // 1 .. 8192
+			},
+		),
+
+		BatchAge: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "click_batch_age_seconds",
+				Help:    "Age of the oldest click in a batch when it was flushed",
+				Buckets: prometheus.ExponentialBuckets(0.01, 2, 12), // 10ms .. ~20s
+			},
+		),
+
+		BatchTargetSize: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "click_batch_target_size",
+				Help: "Current batch size threshold chosen by the adaptive batcher",
+			},
+		),
+
+		BatchTargetLatency: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "click_batch_target_latency_seconds",
+				Help: "Current linger threshold chosen by the adaptive batcher",
+			},
+		),
+
+		BatchRetries: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "click_batch_retries_total",
+				Help: "Number of times a failed click batch was written again",
+			},
+		),
+
+		ClicksQuarantined: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "clicks_quarantined_total",
+				Help: "Number of clicks moved to clicks_quarantine after failing permanently",
+			},
+		),
+
+		// Fallback metrics
+		ClicksSpooled: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "clicks_spooled_total",
+				Help: "Clicks written to the local disk spool while Postgres was unavailable",
+			},
+		),
+
+		ClicksDrained: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "clicks_drained_total",
+				Help: "Clicks taken back from the local disk spool for writing",
+			},
+		),
+
+		SpoolBacklog: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "click_spool_backlog",
+				Help: "Clicks currently held in the local disk spool",
+			},
+		),
+
+		StaleAnalytics: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "analytics_stale_responses_total",
+				Help: "Analytics responses served from cache because the database was unavailable",
+			},
+		),
+
+		// Circuit breaker metrics
+		BreakerState: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "circuit_breaker_state",
+				Help: "Circuit breaker state (0 closed, 1 open, 2 half-open)",
+			},
+			[]string{"breaker"},
+		),
+
+		BreakerRejections: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "circuit_breaker_rejections_total",
+				Help: "Calls rejected because the circuit breaker was open",
+			},
+			[]string{"breaker"},
+		),
+
+		BreakerTransitions: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "circuit_breaker_transitions_total",
+				Help: "Circuit breaker state transitions",
+			},
+			[]string{"breaker", "from", "to"},
+		),
+
+		// Bulkhead metrics
+		BulkheadInFlight: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "bulkhead_in_flight",
+				Help: "Calls currently holding a bulkhead slot",
+			},
+			[]string{"bulkhead"},
+		),
+
+		BulkheadRejections: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "bulkhead_rejections_total",
+				Help: "Calls rejected because no bulkhead slot freed up in time",
+			},
+			[]string{"bulkhead"},
+		),
+
+		BulkheadWait: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "bulkhead_wait_seconds",
+				Help:    "Time spent queueing for a bulkhead slot",
+				Buckets: []float64{.0005, .001, .005, .01, .05, .1, .25, .5, 1, 2.5},
+			},
+			[]string{"bulkhead"},
+		),
+
+		// Health check metrics
+		HealthCheckUp: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "health_check_up",
+				Help: "Whether a health check passed on its last run (1) or failed (0)",
+			},
+			[]string{"probe", "check"},
+		),
+
+		// End-to-end click latency metrics
+		ClickStageLatency: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "click_stage_latency_seconds",
+				Help:    "Time clicks spend between pipeline stages (publish_to_consume, consume_to_commit, ingest_to_commit)",
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 19), // 1ms to ~4.5m
+			},
+			[]string{"stage"},
+		),
+
+		// Reconciliation metrics
+		ClickCounterDrift: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ad_click_counter_drift",
+				Help: "Sum of absolute differences between ads.total_clicks and stored click rows at the last reconciliation",
+			},
+		),
+
+		ClickCounterDriftedAds: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "ad_click_counter_drifted_ads",
+				Help: "Number of ads whose total_clicks counter disagreed with stored click rows at the last reconciliation",
+			},
+		),
+
+		// System metrics
+		ActiveConnections: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "active_connections",
+				Help: "Number of active connections",
+			},
+		),
+
+		ErrorTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "errors_total",
+				Help: "Total number of errors",
+			},
+			[]string{"error_type", "component"},
+		),
+	}
+}
+
+// Gatherer returns what the registry's collectors are gathered from
+func (r *Registry) Gatherer() prometheus.Gatherer {
+	return r.gatherer
+}
+
+// Handler serves the registry's metrics in the Prometheus exposition format
+func (r *Registry) Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(r.registerer, promhttp.HandlerFor(r.gatherer, promhttp.HandlerOpts{}))
+}
+
+// UnmatchedRoute is the endpoint label of requests no route matched
+const UnmatchedRoute = "unmatched"
+
+// RouteLabel returns the endpoint label for a request given its route
+// template (gin's FullPath), never the raw path, so IDs in paths and scans of
+// unknown URLs don't each become a series
+func RouteLabel(fullPath string) string {
+	if fullPath == "" {
+		return UnmatchedRoute
+	}
+	return fullPath
+}
 
 // RecordHTTPRequest records HTTP request metrics
-func RecordHTTPRequest(method, endpoint, statusCode string, duration float64) {
-	RequestTotal.WithLabelValues(method, endpoint, statusCode).Inc()
-	RequestDuration.WithLabelValues(method, endpoint).Observe(duration)
+func (r *Registry) RecordHTTPRequest(method, endpoint, statusCode string, duration float64) {
+	r.RequestTotal.WithLabelValues(method, endpoint, statusCode).Inc()
+	r.RequestDuration.WithLabelValues(method, endpoint).Observe(duration)
 }
 
 // RecordClick records ad click metrics
-func RecordClick(adID string, duration float64) {
-	ClickTotal.WithLabelValues(adID).Inc()
-	ClickProcessingDuration.Observe(duration)
+func (r *Registry) RecordClick(adID string, duration float64) {
+	if r.adLabels != nil {
+		r.adLabels.inc(r.ClickTotal, adID, time.Now())
+	} else {
+		r.ClickTotal.WithLabelValues(adID).Inc()
+	}
+	r.ClickProcessingDuration.Observe(duration)
 }
 
 // RecordDatabaseOperation records database operation metrics
-func RecordDatabaseOperation(operation, status string, duration float64) {
-	DatabaseOperationTotal.WithLabelValues(operation, status).Inc()
-	DatabaseOperationDuration.WithLabelValues(operation).Observe(duration)
+func (r *Registry) RecordDatabaseOperation(operation, status string, duration float64) {
+	r.DatabaseOperationTotal.WithLabelValues(operation, status).Inc()
+	r.DatabaseOperationDuration.WithLabelValues(operation).Observe(duration)
 }
 
 // RecordRedisOperation records Redis operation metrics
-func RecordRedisOperation(operation, status string, duration float64) {
-	RedisOperationTotal.WithLabelValues(operation, status).Inc()
-	RedisOperationDuration.WithLabelValues(operation).Observe(duration)
+func (r *Registry) RecordRedisOperation(operation, status string, duration float64) {
+	r.RedisOperationTotal.WithLabelValues(operation, status).Inc()
+	r.RedisOperationDuration.WithLabelValues(operation).Observe(duration)
 }
 
 // RecordError records error metrics
-func RecordError(errorType, component string) {
-	ErrorTotal.WithLabelValues(errorType, component).Inc()
+func (r *Registry) RecordError(errorType, component string) {
+	r.ErrorTotal.WithLabelValues(errorType, component).Inc()
 }
 
 // UpdateQueueSize updates queue size metrics
-func UpdateQueueSize(queueName string, size float64) {
-	QueueSize.WithLabelValues(queueName).Set(size)
+func (r *Registry) UpdateQueueSize(queueName string, size float64) {
+	r.QueueSize.WithLabelValues(queueName).Set(size)
 }
 
 // RecordQueueProcessing records queue processing metrics
-func RecordQueueProcessing(queueName string, duration float64) {
-	QueueProcessingDuration.WithLabelValues(queueName).Observe(duration)
+func (r *Registry) RecordQueueProcessing(queueName string, duration float64) {
+	r.QueueProcessingDuration.WithLabelValues(queueName).Observe(duration)
+}
+
+// RecordClickDrift records the outcome of a click counter reconciliation
+func (r *Registry) RecordClickDrift(driftedAds int, totalDrift int64) {
+	r.ClickCounterDriftedAds.Set(float64(driftedAds))
+	r.ClickCounterDrift.Set(float64(totalDrift))
+}
+
+// RecordBatch records the size and age of a flushed click batch
+func (r *Registry) RecordBatch(size int, age float64) {
+	r.BatchSize.Observe(float64(size))
+	r.BatchAge.Observe(age)
+}
+
+// UpdateBatchTargets records the adaptive batcher's current thresholds
+func (r *Registry) UpdateBatchTargets(size int, latency float64) {
+	r.BatchTargetSize.Set(float64(size))
+	r.BatchTargetLatency.Set(latency)
+}
+
+// RecordBatchRetry records a retry of a failed click batch
+func (r *Registry) RecordBatchRetry() {
+	r.BatchRetries.Inc()
+}
+
+// RecordQuarantinedClicks records clicks set aside after a permanent write failure
+func (r *Registry) RecordQuarantinedClicks(n int) {
+	r.ClicksQuarantined.Add(float64(n))
+}
+
+// SetBreakerState records a circuit breaker's current state
+func (r *Registry) SetBreakerState(name string, state int) {
+	r.BreakerState.WithLabelValues(name).Set(float64(state))
+}
+
+// RecordBreakerRejection records a call rejected by a circuit breaker
+func (r *Registry) RecordBreakerRejection(name string) {
+	r.BreakerRejections.WithLabelValues(name).Inc()
+}
+
+// RecordBreakerTransition records a circuit breaker changing state
+func (r *Registry) RecordBreakerTransition(name, from, to string, state int) {
+	r.BreakerTransitions.WithLabelValues(name, from, to).Inc()
+	r.SetBreakerState(name, state)
+}
+
+// RecordSpooled records clicks written to the disk spool
+func (r *Registry) RecordSpooled(n int, backlog int64) {
+	r.ClicksSpooled.Add(float64(n))
+	r.UpdateSpoolBacklog(backlog)
+}
+
+// RecordDrained records clicks taken back from the disk spool
+func (r *Registry) RecordDrained(n int, backlog int64) {
+	r.ClicksDrained.Add(float64(n))
+	r.UpdateSpoolBacklog(backlog)
+}
+
+// UpdateSpoolBacklog records how many clicks the disk spool holds
+func (r *Registry) UpdateSpoolBacklog(backlog int64) {
+	r.SpoolBacklog.Set(float64(backlog))
+}
+
+// RecordStaleAnalytics records an analytics response served from cache
+func (r *Registry) RecordStaleAnalytics() {
+	r.StaleAnalytics.Inc()
+}
+
+// UpdateBulkheadInFlight records how many slots of a bulkhead are taken
+func (r *Registry) UpdateBulkheadInFlight(name string, inFlight int) {
+	r.BulkheadInFlight.WithLabelValues(name).Set(float64(inFlight))
+}
+
+// RecordBulkheadWait records the time a call queued for a bulkhead slot
+func (r *Registry) RecordBulkheadWait(name string, wait float64) {
+	r.BulkheadWait.WithLabelValues(name).Observe(wait)
+}
+
+// RecordBulkheadRejection records a call that timed out waiting for a slot
+func (r *Registry) RecordBulkheadRejection(name string) {
+	r.BulkheadRejections.WithLabelValues(name).Inc()
+}
+
+// SetHealthCheck records the outcome of a health check
+func (r *Registry) SetHealthCheck(probe, check string, up bool) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	r.HealthCheckUp.WithLabelValues(probe, check).Set(value)
+}
+
+// RecordClickStageLatency records the time a click took between two pipeline
+// stages, also feeding the recent maximum reported by StageLags
+func (r *Registry) RecordClickStageLatency(stage string, latency time.Duration) {
+	r.ClickStageLatency.WithLabelValues(stage).Observe(latency.Seconds())
+	r.stageLags.observe(stage, latency, time.Now())
 }
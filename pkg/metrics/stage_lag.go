@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Click pipeline stages
+const (
+	StagePublishToConsume = "publish_to_consume" // published to NATS until a consumer picked it up
+	StageConsumeToCommit  = "consume_to_commit"  // picked up until its batch was committed
+	StageIngestToCommit   = "ingest_to_commit"   // accepted by the API until its batch was committed
+)
+
+// StageLagWindow is how far back StageLags looks for the maximum latency
+const StageLagWindow = time.Minute
+
+// The window is kept as a ring of buckets; the oldest one is recycled as time
+// moves on, so the reported maximum covers between 50 and 60 seconds
+const (
+	stageLagBuckets     = 6
+	stageLagBucketWidth = StageLagWindow / stageLagBuckets
+)
+
+// StageLag summarizes a pipeline stage's recent latency
+type StageLag struct {
+	Stage          string    `json:"stage"`
+	MaxSeconds     float64   `json:"max_seconds"`  // highest latency within the window
+	LastSeconds    float64   `json:"last_seconds"` // latest observation, however old
+	Samples        int       `json:"samples"`      // observations within the window
+	LastObservedAt time.Time `json:"last_observed_at"`
+}
+
+type lagBucket struct {
+	start   time.Time
+	max     time.Duration
+	samples int
+}
+
+type stageLag struct {
+	buckets [stageLagBuckets]lagBucket
+	last    time.Duration
+	lastAt  time.Time
+}
+
+type stageLagTracker struct {
+	mu     sync.Mutex
+	stages map[string]*stageLag
+}
+
+func newStageLagTracker() *stageLagTracker {
+	return &stageLagTracker{stages: map[string]*stageLag{}}
+}
+
+func (t *stageLagTracker) observe(stage string, latency time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.stages[stage]
+	if !ok {
+		s = &stageLag{}
+		t.stages[stage] = s
+	}
+
+	start := now.Truncate(stageLagBucketWidth)
+	b := &s.buckets[(start.UnixNano()/int64(stageLagBucketWidth))%stageLagBuckets]
+	if !b.start.Equal(start) {
+		*b = lagBucket{start: start}
+	}
+	b.max = max(b.max, latency)
+	b.samples++
+
+	s.last, s.lastAt = latency, now
+}
+
+func (t *stageLagTracker) snapshot(now time.Time) []StageLag {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	oldest := now.Truncate(stageLagBucketWidth).Add(-StageLagWindow + stageLagBucketWidth)
+	lags := make([]StageLag, 0, len(t.stages))
+	for name, s := range t.stages {
+		lag := StageLag{
+			Stage:          name,
+			LastSeconds:    s.last.Seconds(),
+			LastObservedAt: s.lastAt,
+		}
+		for _, b := range s.buckets {
+			if b.start.Before(oldest) {
+				continue
+			}
+			lag.MaxSeconds = max(lag.MaxSeconds, b.max.Seconds())
+			lag.Samples += b.samples
+		}
+		lags = append(lags, lag)
+	}
+
+	sort.Slice(lags, func(i, j int) bool { return lags[i].Stage < lags[j].Stage })
+	return lags
+}
+
+// StageLags returns the recent latency of every pipeline stage seen so far
+func (r *Registry) StageLags() []StageLag {
+	return r.stageLags.snapshot(time.Now())
+}